@@ -0,0 +1,137 @@
+// Package auth authenticates long-polling, SSE and WebSocket clients. An
+// Authenticator turns a request's credentials into an Identity: the client ID
+// to subscribe as and the topic patterns the client may subscribe to.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrNoCredentials means the request carried no token.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidToken means the token was present but not accepted.
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Identity is who a request was authenticated as.
+type Identity struct {
+	ClientID string   `json:"client_id"`
+	Topics   []string `json:"topics,omitempty"` // Allowed topic patterns; empty allows none, "#" every topic
+	Scopes   []string `json:"scopes,omitempty"` // Extra permissions, e.g. "presence"
+}
+
+// HasScope reports whether the identity was granted scope.
+func (id *Identity) HasScope(scope string) bool {
+	return slices.Contains(id.Scopes, scope)
+}
+
+// Authenticator derives an Identity from a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// AuthenticatorFunc adapts a function to the Authenticator interface.
+type AuthenticatorFunc func(r *http.Request) (*Identity, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Identity, error) {
+	return f(r)
+}
+
+// BearerToken returns the token from an "Authorization: Bearer" header or,
+// failing that, the access_token query parameter. Browsers cannot set headers
+// on EventSource or WebSocket connections, so those clients need the latter.
+func BearerToken(r *http.Request) (string, error) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		scheme, token, ok := strings.Cut(h, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return "", fmt.Errorf("%w: malformed Authorization header", ErrInvalidToken)
+		}
+		return strings.TrimSpace(token), nil
+	}
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return token, nil
+	}
+	return "", ErrNoCredentials
+}
+
+// StaticTokens authenticates opaque bearer tokens against a fixed table.
+type StaticTokens map[string]Identity
+
+// LoadStaticTokens reads a JSON object mapping tokens to identities:
+//
+//	{"s3cret": {"client_id": "dashboard", "topics": ["orders.#"], "scopes": ["presence"]}}
+func LoadStaticTokens(path string) (StaticTokens, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens file: %w", err)
+	}
+	var tokens StaticTokens
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse tokens file: %w", err)
+	}
+	for token, id := range tokens {
+		if id.ClientID == "" {
+			return nil, fmt.Errorf("token %.4s...: client_id is required", token)
+		}
+	}
+	return tokens, nil
+}
+
+func (s StaticTokens) Authenticate(r *http.Request) (*Identity, error) {
+	token, err := BearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	// Compare against every entry so timing does not reveal near misses.
+	var found *Identity
+	for t, id := range s {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			id := id
+			found = &id
+		}
+	}
+	if found == nil {
+		return nil, ErrInvalidToken
+	}
+	return found, nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the Identity stored by NewContext, if any.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(*Identity)
+	return id, ok
+}
+
+// Middleware authenticates each request with a, storing the Identity in the
+// request context. Failures get 401 with a WWW-Authenticate challenge.
+func Middleware(a Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := a.Authenticate(r)
+		if err != nil {
+			challenge := `Bearer realm="updates"`
+			if !errors.Is(err, ErrNoCredentials) {
+				challenge += `, error="invalid_token"`
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
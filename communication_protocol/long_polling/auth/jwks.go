@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// JWKS is a parsed JSON Web Key Set (RFC 7517). RSA keys are used for RS256
+// and symmetric ("oct") keys for HS256.
+type JWKS struct {
+	keys map[string]jwk // By kid
+}
+
+type jwk struct {
+	alg string
+	key any // []byte or *rsa.PublicKey
+}
+
+type rawJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS parses a key set document. Keys meant for encryption ("use":
+// "enc") and unsupported key types are skipped.
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var doc struct {
+		Keys []rawJWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	set := &JWKS{keys: make(map[string]jwk)}
+	for _, k := range doc.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			pub, err := parseRSAKey(k.N, k.E)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+			}
+			set.keys[k.Kid] = jwk{alg: "RS256", key: pub}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: bad k: %w", k.Kid, err)
+			}
+			set.keys[k.Kid] = jwk{alg: "HS256", key: secret}
+		}
+	}
+	if len(set.keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no usable keys")
+	}
+	return set, nil
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("bad modulus: %w", err)
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("bad exponent: %w", err)
+	}
+	exp := new(big.Int).SetBytes(eb)
+	if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("unsupported exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(exp.Int64())}, nil
+}
+
+// Key returns the key with the given kid. A token without a kid is accepted
+// only when the set holds a single key.
+func (s *JWKS) Key(kid, alg string) (any, error) {
+	k, ok := s.keys[kid]
+	if !ok && kid == "" && len(s.keys) == 1 {
+		for _, only := range s.keys {
+			k, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if k.alg != alg {
+		return nil, fmt.Errorf("key %q is for %s, not %s", kid, k.alg, alg)
+	}
+	return k.key, nil
+}
+
+// JWKSFile is a KeySource backed by a JWKS file on disk. The file is re-read
+// when its modification time changes, at most once per CheckInterval, so keys
+// can be rotated without a restart.
+type JWKSFile struct {
+	path          string
+	CheckInterval time.Duration
+
+	mu        sync.Mutex
+	set       *JWKS
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// NewJWKSFile loads the key set at path.
+func NewJWKSFile(path string) (*JWKSFile, error) {
+	f := &JWKSFile{path: path, CheckInterval: 30 * time.Second}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *JWKSFile) reload() error {
+	f.lastCheck = time.Now()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat JWKS file: %w", err)
+	}
+	if f.set != nil && info.ModTime().Equal(f.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	set, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+	f.set, f.modTime = set, info.ModTime()
+	return nil
+}
+
+func (f *JWKSFile) Key(kid, alg string) (any, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if time.Since(f.lastCheck) >= f.CheckInterval {
+		// Keep serving the previous keys if the new file is broken.
+		if err := f.reload(); err != nil {
+			log.Printf("Keeping previous JWKS: %v", err)
+		}
+	}
+	return f.set.Key(kid, alg)
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// KeySource looks up the key to verify a token with. kid is the token's key
+// ID header (possibly empty). It returns a []byte for HS256 or an
+// *rsa.PublicKey for RS256.
+type KeySource interface {
+	Key(kid, alg string) (any, error)
+}
+
+// HMACKey is a KeySource with a single HS256 secret.
+type HMACKey []byte
+
+func (k HMACKey) Key(_, alg string) (any, error) {
+	if alg != "HS256" {
+		return nil, fmt.Errorf("unexpected algorithm %q", alg)
+	}
+	return []byte(k), nil
+}
+
+// RSAKey is a KeySource with a single RS256 public key.
+type RSAKey struct{ *rsa.PublicKey }
+
+func (k RSAKey) Key(_, alg string) (any, error) {
+	if alg != "RS256" {
+		return nil, fmt.Errorf("unexpected algorithm %q", alg)
+	}
+	return k.PublicKey, nil
+}
+
+// JWT authenticates signed JSON Web Tokens (HS256 or RS256). The client ID is
+// taken from the "sub" claim, the allowed topics from a "topics" claim
+// (a list of patterns; absent or empty allows none, ["#"] allows every
+// topic) and scopes from a space-separated "scope" claim. Tokens without an
+// "exp" claim are rejected unless AllowNoExpiry is set.
+type JWT struct {
+	Keys          KeySource
+	Issuer        string        // If set, "iss" must match
+	Audience      string        // If set, "aud" must contain it
+	Leeway        time.Duration // Clock skew tolerated for exp/nbf
+	AllowNoExpiry bool          // Accept tokens without an "exp" claim
+
+	now func() time.Time // For tests
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss"`
+	Audience  audience `json:"aud"`
+	ExpiresAt *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+	Topics    []string `json:"topics"`
+	Scope     string   `json:"scope"` // Space-separated, as in RFC 8693
+}
+
+// audience accepts "aud" as either a string or a list, as RFC 7519 allows.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (j *JWT) Authenticate(r *http.Request) (*Identity, error) {
+	token, err := BearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	return j.Verify(token)
+}
+
+// Verify checks a token's signature and claims and returns its Identity.
+func (j *JWT) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed JWT", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: bad header: %v", ErrInvalidToken, err)
+	}
+	key, err := j.Keys.Key(header.Kid, header.Alg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad claims: %v", ErrInvalidToken, err)
+	}
+	if err := j.checkClaims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return &Identity{ClientID: claims.Subject, Topics: claims.Topics, Scopes: strings.Fields(claims.Scope)}, nil
+}
+
+// verifySignature checks sig over signed. The algorithm must agree with the
+// key type, so an RSA public key can never be used as an HMAC secret.
+func verifySignature(alg string, key any, signed string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("key does not support HS256")
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not support RS256")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+func (j *JWT) checkClaims(c jwtClaims) error {
+	now := time.Now()
+	if j.now != nil {
+		now = j.now()
+	}
+	if c.Subject == "" {
+		return fmt.Errorf("missing sub claim")
+	}
+	if c.ExpiresAt == nil && !j.AllowNoExpiry {
+		return fmt.Errorf("missing exp claim")
+	}
+	if c.ExpiresAt != nil && now.After(time.Unix(*c.ExpiresAt, 0).Add(j.Leeway)) {
+		return fmt.Errorf("token expired")
+	}
+	if c.NotBefore != nil && now.Before(time.Unix(*c.NotBefore, 0).Add(-j.Leeway)) {
+		return fmt.Errorf("token not valid yet")
+	}
+	if j.Issuer != "" && c.Issuer != j.Issuer {
+		return fmt.Errorf("unexpected issuer %q", c.Issuer)
+	}
+	if j.Audience != "" && !slices.Contains(c.Audience, j.Audience) {
+		return fmt.Errorf("token not intended for %q", j.Audience)
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
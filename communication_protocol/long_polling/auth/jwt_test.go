@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func encodeSegment(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	return b64(data)
+}
+
+func signHS256(t *testing.T, secret []byte, header, claims map[string]any) string {
+	t.Helper()
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + b64(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, header, claims map[string]any) string {
+	t.Helper()
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func TestJWTHS256(t *testing.T) {
+	secret := []byte("test-secret")
+	j := &JWT{Keys: HMACKey(secret), Issuer: "poc", Audience: "updates"}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	token := signHS256(t, secret, map[string]any{"alg": "HS256"}, map[string]any{
+		"sub": "dashboard", "iss": "poc", "aud": "updates", "exp": exp, "topics": []string{"orders.#"}, "scope": "presence  admin",
+	})
+	id, err := j.Verify(token)
+	if err != nil {
+		t.Fatalf("expected a valid token, got %v", err)
+	}
+	if id.ClientID != "dashboard" || len(id.Topics) != 1 || id.Topics[0] != "orders.#" {
+		t.Fatalf("unexpected identity %+v", id)
+	}
+	if !id.HasScope("presence") || !id.HasScope("admin") || len(id.Scopes) != 2 {
+		t.Fatalf("unexpected scopes %q", id.Scopes)
+	}
+
+	bad := map[string]map[string]any{
+		"expired":       {"sub": "x", "iss": "poc", "aud": "updates", "exp": time.Now().Add(-time.Hour).Unix()},
+		"wrong issuer":  {"sub": "x", "iss": "other", "aud": "updates", "exp": exp},
+		"wrong aud":     {"sub": "x", "iss": "poc", "aud": []string{"billing"}, "exp": exp},
+		"missing sub":   {"iss": "poc", "aud": "updates", "exp": exp},
+		"not yet valid": {"sub": "x", "iss": "poc", "aud": "updates", "exp": exp, "nbf": time.Now().Add(time.Hour).Unix()},
+		"no expiry":     {"sub": "x", "iss": "poc", "aud": "updates"},
+	}
+	for name, claims := range bad {
+		if _, err := j.Verify(signHS256(t, secret, map[string]any{"alg": "HS256"}, claims)); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+	j.AllowNoExpiry = true
+	if _, err := j.Verify(signHS256(t, secret, map[string]any{"alg": "HS256"}, bad["no expiry"])); err != nil {
+		t.Errorf("expected a token without exp to be accepted with AllowNoExpiry, got %v", err)
+	}
+	if _, err := j.Verify(signHS256(t, []byte("other"), map[string]any{"alg": "HS256"}, map[string]any{"sub": "x"})); err == nil {
+		t.Errorf("expected a token signed with another secret to be rejected")
+	}
+	if _, err := j.Verify(encodeSegment(t, map[string]any{"alg": "none"}) + "." + encodeSegment(t, map[string]any{"sub": "x"}) + "."); err == nil {
+		t.Errorf("expected an unsigned token to be rejected")
+	}
+}
+
+func TestJWTRS256WithJWKSFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	jwks := map[string]any{"keys": []map[string]any{{
+		"kty": "RSA",
+		"kid": "k1",
+		"use": "sig",
+		"n":   b64(key.N.Bytes()),
+		"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	data, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write JWKS: %v", err)
+	}
+	keys, err := NewJWKSFile(path)
+	if err != nil {
+		t.Fatalf("failed to load JWKS: %v", err)
+	}
+	j := &JWT{Keys: keys}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	token := signRS256(t, key, map[string]any{"alg": "RS256", "kid": "k1"}, map[string]any{"sub": "mobile", "exp": exp})
+	req := httptest.NewRequest("GET", "/updates", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	id, err := j.Authenticate(req)
+	if err != nil || id.ClientID != "mobile" {
+		t.Fatalf("expected mobile, got %+v (%v)", id, err)
+	}
+
+	// Algorithm confusion: using the public key as an HMAC secret must fail.
+	forged := signHS256(t, key.N.Bytes(), map[string]any{"alg": "HS256", "kid": "k1"}, map[string]any{"sub": "attacker"})
+	if _, err := j.Verify(forged); err == nil {
+		t.Fatalf("expected an HS256 token against an RSA key to be rejected")
+	}
+	if _, err := j.Verify(signRS256(t, key, map[string]any{"alg": "RS256", "kid": "k2"}, map[string]any{"sub": "x"})); err == nil {
+		t.Fatalf("expected an unknown kid to be rejected")
+	}
+}
+
+func TestStaticTokensAndMiddleware(t *testing.T) {
+	tokens := StaticTokens{"s3cret": {ClientID: "dashboard"}}
+
+	req := httptest.NewRequest("GET", "/events?access_token=s3cret", nil)
+	id, err := tokens.Authenticate(req)
+	if err != nil || id.ClientID != "dashboard" {
+		t.Fatalf("expected dashboard, got %+v (%v)", id, err)
+	}
+
+	var got *Identity
+	h := Middleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/updates", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || got == nil || got.ClientID != "dashboard" {
+		t.Fatalf("expected the identity in the context, got %d %+v", w.Code, got)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/updates", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected 401 with a challenge, got %d", w.Code)
+	}
+}
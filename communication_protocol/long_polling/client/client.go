@@ -0,0 +1,256 @@
+// Package client is a Go client for the /updates long-polling endpoint. It
+// polls in a loop, resumes from the last cursor it saw, and backs off with
+// jitter when the server is unreachable or failing.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Update is a single update as returned by /updates.
+type Update struct {
+	ID    uint64 `json:"id"`
+	Topic string `json:"topic,omitempty"`
+	Data  string `json:"data"`
+}
+
+// Response is the body of a successful poll.
+type Response struct {
+	Updates   []Update `json:"updates"`
+	Cursor    uint64   `json:"cursor"`
+	Truncated bool     `json:"truncated,omitempty"` // Also set from X-Truncated on 204 and 304
+}
+
+// Config configures a Client. URL and ClientID are required.
+type Config struct {
+	URL        string        // Full URL of the endpoint, e.g. http://localhost:8080/updates
+	ClientID   string        // Sent as ?clientID=
+	Token      string        // Bearer token, if the server requires authentication
+	Topics     []string      // Topic patterns; empty means everything
+	Cursor     uint64        // Resume point; 0 starts from "now"
+	Timeout    time.Duration // Server-side poll timeout passed as ?timeout= (default 30s)
+	HTTPClient *http.Client  // Defaults to a client whose timeout exceeds Timeout
+
+	MinBackoff time.Duration // First retry delay after an error (default 500ms)
+	MaxBackoff time.Duration // Upper bound on retry delay (default 30s)
+
+	// OnTruncated, if set, is called when the server could not return every
+	// update since the cursor (its history was exceeded, or it restarted).
+	OnTruncated func()
+	// OnError, if set, is called with each error that will be retried.
+	OnError func(err error)
+}
+
+// StatusError is returned for responses other than 200, 204 and 304.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Message)
+}
+
+// temporary reports whether retrying the same request may succeed.
+func (e *StatusError) temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
+// Client polls /updates. It is safe to read Cursor while Run is active, but
+// only one Run (or Updates) loop should be active at a time.
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	mu     sync.Mutex
+	cursor uint64
+}
+
+// New creates a Client, filling in defaults.
+func New(cfg Config) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("client: URL is required")
+	}
+	if cfg.ClientID == "" {
+		return nil, errors.New("client: ClientID is required")
+	}
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("client: invalid URL: %w", err)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(30*time.Second, cfg.MinBackoff)
+	}
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		// Leave room for the server to hold the request for the full timeout.
+		httpClient = &http.Client{Timeout: cfg.Timeout + 10*time.Second}
+	}
+	return &Client{cfg: cfg, http: httpClient, cursor: cfg.Cursor}, nil
+}
+
+// Cursor returns the ID of the last update received, to resume from later.
+func (c *Client) Cursor() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cursor
+}
+
+// Poll performs a single long poll. It returns an empty Response (and no
+// error) when the server timed out with nothing new. The cursor is advanced
+// past whatever was returned, or moved back to the server's if the server
+// is behind it (e.g. after a restart), which is reported as truncation.
+func (c *Client) Poll(ctx context.Context) (Response, error) {
+	cursor := c.Cursor()
+
+	q := url.Values{}
+	q.Set("clientID", c.cfg.ClientID)
+	q.Set("timeout", c.cfg.Timeout.String())
+	if cursor > 0 {
+		q.Set("since", strconv.FormatUint(cursor, 10))
+	}
+	for _, t := range c.cfg.Topics {
+		q.Add("topic", t)
+	}
+	u, _ := url.Parse(c.cfg.URL) // Validated in New
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Response{}, err
+	}
+	if c.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent, http.StatusNotModified:
+		resp := Response{Cursor: cursor, Truncated: res.Header.Get("X-Truncated") == "true"}
+		if next, err := strconv.ParseUint(res.Header.Get("X-Cursor"), 10, 64); err == nil && (cursor == 0 || next < cursor) {
+			// Pin "now" so updates arriving before the next poll are not
+			// missed, or drop a cursor the server no longer knows.
+			resp.Cursor = next
+			resp.Truncated = resp.Truncated || cursor > 0
+			c.setCursor(next)
+		}
+		return resp, nil
+	default:
+		var body struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		if json.Unmarshal(data, &body) != nil {
+			body.Error = string(data)
+		}
+		return Response{}, &StatusError{StatusCode: res.StatusCode, Message: body.Error}
+	}
+
+	var resp Response
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return Response{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if resp.Cursor < cursor {
+		resp.Truncated = true
+	}
+	c.setCursor(resp.Cursor)
+	return resp, nil
+}
+
+func (c *Client) setCursor(cursor uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cursor = cursor
+}
+
+// Run polls until ctx is done, calling fn for each update in order. Network
+// errors and 5xx/408/429 responses are retried with jittered exponential
+// backoff; other 4xx responses stop the loop and are returned, since
+// repeating the request will not help. Run returns ctx.Err() on cancellation.
+func (c *Client) Run(ctx context.Context, fn func(Update)) error {
+	attempt := 0
+	for {
+		resp, err := c.Poll(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			var se *StatusError
+			if errors.As(err, &se) && !se.temporary() {
+				return err
+			}
+			if c.cfg.OnError != nil {
+				c.cfg.OnError(err)
+			}
+			select {
+			case <-time.After(c.backoff(attempt)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			attempt++
+			continue
+		}
+		attempt = 0
+
+		if resp.Truncated && c.cfg.OnTruncated != nil {
+			c.cfg.OnTruncated()
+		}
+		for _, u := range resp.Updates {
+			fn(u)
+		}
+	}
+}
+
+// Updates runs the poll loop in a goroutine and delivers updates on the
+// returned channel, which is closed when the loop ends. The loop blocks while
+// the channel is full, so a slow reader delays polling rather than losing
+// updates. The error that ended the loop is sent on errc.
+func (c *Client) Updates(ctx context.Context) (updates <-chan Update, errc <-chan error) {
+	ch := make(chan Update, 64)
+	ec := make(chan error, 1)
+	go func() {
+		defer close(ch)
+		ec <- c.Run(ctx, func(u Update) {
+			select {
+			case ch <- u:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return ch, ec
+}
+
+// backoff returns the delay before retry number attempt (0-based): a random
+// duration up to MinBackoff*2^attempt, capped at MaxBackoff ("full jitter").
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.cfg.MaxBackoff
+	if attempt < 30 {
+		if exp := c.cfg.MinBackoff << attempt; exp > 0 && exp < d {
+			d = exp
+		}
+	}
+	return rand.N(d) + 1
+}
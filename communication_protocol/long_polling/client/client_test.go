@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer speaks the /updates protocol over a fixed log of updates.
+// failures makes the first N polls fail with 503.
+type fakeServer struct {
+	mu       sync.Mutex
+	log      []Update
+	failures int
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Query().Get("clientID") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "clientID is required"})
+		return
+	}
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	// Like the real server, no cursor means "from now".
+	since := uint64(len(s.log))
+	if v := r.URL.Query().Get("since"); v != "" {
+		since, _ = strconv.ParseUint(v, 10, 64)
+	}
+	var resp Response
+	if since > uint64(len(s.log)) {
+		// A cursor ahead of the log gets everything retained, as after a
+		// server restart.
+		since, resp.Truncated = 0, true
+	}
+	for _, u := range s.log {
+		if u.ID > since {
+			resp.Updates = append(resp.Updates, u)
+		}
+	}
+	if len(resp.Updates) == 0 {
+		w.Header().Set("X-Cursor", strconv.Itoa(len(s.log)))
+		if resp.Truncated {
+			w.Header().Set("X-Truncated", "true")
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp.Cursor = resp.Updates[len(resp.Updates)-1].ID
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *fakeServer) add(data ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range data {
+		s.log = append(s.log, Update{ID: uint64(len(s.log) + 1), Data: d})
+	}
+}
+
+func newTestClient(t *testing.T, url string, cursor uint64) *Client {
+	t.Helper()
+	c, err := New(Config{
+		URL:        url,
+		ClientID:   "test",
+		Cursor:     cursor,
+		Timeout:    10 * time.Millisecond,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return c
+}
+
+// Test that the loop retries through server errors, resumes from the cursor
+// and delivers every update once, in order, over the channel.
+func TestUpdatesRetriesAndResumes(t *testing.T) {
+	srv := &fakeServer{failures: 3}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	srv.add("seen", "a", "b")
+	c := newTestClient(t, ts.URL, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var errs int
+	c.cfg.OnError = func(error) { errs++ }
+	updates, errc := c.Updates(ctx)
+
+	var got []string
+	for len(got) < 4 {
+		select {
+		case u := <-updates:
+			got = append(got, u.Data)
+			if len(got) == 2 {
+				srv.add("c", "d")
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out, received %v", got)
+		}
+	}
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	if want := []string{"a", "b", "c", "d"}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if errs != 3 {
+		t.Fatalf("expected 3 retried errors, got %d", errs)
+	}
+	if c.Cursor() != 5 {
+		t.Fatalf("expected cursor 5, got %d", c.Cursor())
+	}
+}
+
+// Test that a 204 with no cursor pins the client to the server's head, so
+// updates published between polls are not skipped.
+func TestPollPinsCursorOnTimeout(t *testing.T) {
+	srv := &fakeServer{}
+	srv.add("old-1", "old-2")
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL, 0)
+	resp, err := c.Poll(context.Background())
+	if err != nil || len(resp.Updates) != 0 {
+		t.Fatalf("expected an empty poll, got %+v (%v)", resp, err)
+	}
+
+	srv.add("new")
+	resp, err = c.Poll(context.Background())
+	if err != nil || len(resp.Updates) != 1 || resp.Updates[0].Data != "new" {
+		t.Fatalf("expected the new update, got %+v (%v)", resp, err)
+	}
+}
+
+// Test that a cursor the server no longer knows is replaced by the server's,
+// with truncation reported, whether or not there is anything to return.
+func TestPollAdoptsLowerServerCursor(t *testing.T) {
+	srv := &fakeServer{}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL, 10)
+	resp, err := c.Poll(context.Background())
+	if err != nil || !resp.Truncated || len(resp.Updates) != 0 || c.Cursor() != 0 {
+		t.Fatalf("expected an empty truncated poll resetting the cursor, got %+v cursor=%d (%v)", resp, c.Cursor(), err)
+	}
+
+	srv.add("a", "b")
+	c = newTestClient(t, ts.URL, 10)
+	var truncations int
+	c.cfg.OnTruncated = func() { truncations++ }
+	ctx, cancel := context.WithCancel(context.Background())
+	var got []string
+	err = c.Run(ctx, func(u Update) {
+		got = append(got, u.Data)
+		if len(got) == 2 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if !slices.Equal(got, []string{"a", "b"}) || truncations != 1 || c.Cursor() != 2 {
+		t.Fatalf("expected [a b] after one truncation with cursor 2, got %v, %d truncations, cursor %d", got, truncations, c.Cursor())
+	}
+}
+
+// Test that a client error ends Run instead of retrying forever.
+func TestRunStopsOnClientError(t *testing.T) {
+	ts := httptest.NewServer(&fakeServer{})
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL, 0)
+	c.cfg.ClientID = "" // Bypass New's validation to provoke a 400
+
+	err := c.Run(context.Background(), func(Update) {})
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusBadRequest || se.Message != "clientID is required" {
+		t.Fatalf("expected a 400 StatusError, got %v", err)
+	}
+}
+
+func TestBackoffIsBounded(t *testing.T) {
+	c := newTestClient(t, "http://example.invalid", 0)
+	for attempt := 0; attempt < 100; attempt++ {
+		d := c.backoff(attempt)
+		if d <= 0 || d > c.cfg.MaxBackoff {
+			t.Fatalf("attempt %d: backoff %v out of range", attempt, d)
+		}
+	}
+}
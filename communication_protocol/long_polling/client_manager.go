@@ -1,47 +1,443 @@
 package long_polling
 
 import (
+	"fmt"
 	"sync"
+	"time"
 )
 
+// DefaultBufferSize is the per-subscription channel capacity used unless
+// configured otherwise.
+const DefaultBufferSize = 16
+
+// OverflowPolicy decides what happens when an update is published to a
+// subscription whose buffer is full.
+type OverflowPolicy int
+
+const (
+	// Disconnect removes the subscription (closing its channel) so the client
+	// reconnects with its last seen ID and catches up from the log. Nothing is
+	// lost as long as the log still holds the gap. This is the default.
+	Disconnect OverflowPolicy = iota
+	// DropOldest discards the oldest queued update to make room.
+	DropOldest
+	// DropNewest discards the update being published.
+	DropNewest
+	// Coalesce keeps only the newest queued update per topic, for topics where
+	// the latest value supersedes earlier ones. If every queued update has a
+	// distinct topic it falls back to DropOldest.
+	Coalesce
+)
+
+var overflowPolicyNames = map[OverflowPolicy]string{
+	Disconnect: "disconnect",
+	DropOldest: "drop-oldest",
+	DropNewest: "drop-newest",
+	Coalesce:   "coalesce",
+}
+
+func (p OverflowPolicy) String() string {
+	if name, ok := overflowPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+// ParseOverflowPolicy parses a policy name as returned by String.
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	for p, n := range overflowPolicyNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow policy %q", name)
+}
+
+// BufferConfig sets a subscription's channel capacity and what happens when
+// it fills up.
+type BufferConfig struct {
+	Size   int // Defaults to DefaultBufferSize
+	Policy OverflowPolicy
+}
+
+// Drop describes updates a subscription lost to its overflow policy.
+type Drop struct {
+	ClientID       string
+	SubscriptionID uint64
+	Policy         OverflowPolicy
+	Updates        []Update // What was discarded
+	Disconnected   bool     // The subscription was removed (Disconnect policy)
+}
+
+// Update is a published message stamped with a monotonically increasing
+// sequence number (ID), usable as a resume cursor.
+type Update struct {
+	ID    uint64 `json:"id"`
+	Topic string `json:"topic,omitempty"`
+	Data  string `json:"data"`
+}
+
+// Backlog is what a new subscription missed since the cursor it passed in.
+type Backlog struct {
+	Updates   []Update
+	Cursor    uint64 // Log head; every update up to here was considered
+	Truncated bool   // Some updates after the cursor are no longer retained
+}
+
+// Subscription is a single registered listener. A client may hold several at
+// once (e.g. two browser tabs polling with the same clientID); each has its own
+// channel and a unique ID, so removing one never affects the others.
+type Subscription struct {
+	ID       uint64
+	ClientID string
+	topics   []string // Topic patterns; empty means every topic
+	ch       chan Update
+	policy   OverflowPolicy
+	dropped  uint64 // Guarded by ClientManager.mu
+}
+
+// Updates returns the channel updates are delivered on. It is closed when the
+// subscription is removed, either by Unsubscribe or because it fell too far
+// behind under the Disconnect policy.
+func (s *Subscription) Updates() <-chan Update {
+	return s.ch
+}
+
 // ClientManager manages connected clients for long polling.
 type ClientManager struct {
-	clients map[string]chan string // Map clientID to a channel for updates
-	mu      sync.RWMutex
+	clients       map[string]map[uint64]*Subscription // Map clientID to its subscriptions
+	log           *UpdateLog                          // Recent broadcasts, for cursor-based resume
+	nextSub       uint64
+	buffer        BufferConfig            // Default for new subscriptions
+	clientBuffers map[string]BufferConfig // Per-client overrides
+	dropped       map[string]uint64       // Updates lost per client, across subscriptions
+	onDrop        func(Drop)
+	presence      map[string]*presence // Online clients; nil if presence is disabled
+	presenceGrace time.Duration
+	mu            sync.RWMutex
 }
 
-func NewClientManager() *ClientManager {
-	return &ClientManager{
-		clients: make(map[string]chan string),
+// Option configures a ClientManager.
+type Option func(*ClientManager)
+
+// WithLogSize sets how many recent updates are retained for resuming clients.
+func WithLogSize(n int) Option {
+	return func(cm *ClientManager) {
+		cm.log = NewUpdateLog(n)
 	}
 }
 
-func (cm *ClientManager) RegisterClient(clientID string) chan string {
+// WithBuffer sets the buffer size and overflow policy for subscriptions of
+// clients without a SetClientBuffer override.
+func WithBuffer(cfg BufferConfig) Option {
+	return func(cm *ClientManager) {
+		cm.buffer = cfg
+	}
+}
+
+// WithDropHook registers fn to be called whenever a subscription loses
+// updates to its overflow policy. It is called after the manager's lock is
+// released, so it may call back into the ClientManager, but it runs on the
+// publishing goroutine and should not block.
+func WithDropHook(fn func(Drop)) Option {
+	return func(cm *ClientManager) {
+		cm.onDrop = fn
+	}
+}
+
+func NewClientManager(opts ...Option) *ClientManager {
+	cm := &ClientManager{
+		clients:       make(map[string]map[uint64]*Subscription),
+		log:           NewUpdateLog(DefaultLogSize),
+		clientBuffers: make(map[string]BufferConfig),
+		dropped:       make(map[string]uint64),
+	}
+	for _, opt := range opts {
+		opt(cm)
+	}
+	return cm
+}
+
+// Subscribe registers a new subscription for clientID and returns it together
+// with the retained updates newer than since, so a reconnecting client can
+// resume without gaps. Pass 0 to receive only new updates. If topic patterns
+// are given, only updates whose topic matches one of them are delivered;
+// callers should check them with ValidateTopicPattern first.
+func (cm *ClientManager) Subscribe(clientID string, since uint64, topics ...string) (*Subscription, Backlog) {
+	cm.mu.Lock()
+	// Announce a join before the subscription exists, so the client does not
+	// receive its own join event; presence is never logged, so the backlog
+	// cannot replay it either.
+	drops := cm.markSeenLocked(clientID)
+
+	buffer, ok := cm.clientBuffers[clientID]
+	if !ok {
+		buffer = cm.buffer
+	}
+	if buffer.Size <= 0 {
+		buffer.Size = DefaultBufferSize
+	}
+
+	cm.nextSub++
+	sub := &Subscription{
+		ID:       cm.nextSub,
+		ClientID: clientID,
+		topics:   append([]string(nil), topics...),
+		ch:       make(chan Update, buffer.Size),
+		policy:   buffer.Policy,
+	}
+	subs, ok := cm.clients[clientID]
+	if !ok {
+		subs = make(map[uint64]*Subscription)
+		cm.clients[clientID] = subs
+	}
+	subs[sub.ID] = sub
+
+	// Broadcasts hold cm.mu while appending, so nothing can slip in between
+	// reading the backlog and the subscription going live.
+	backlog := Backlog{Cursor: cm.log.LastID()}
+	if since > 0 {
+		missed, truncated := cm.log.Since(since)
+		for _, u := range missed {
+			if matchAny(sub.topics, u.Topic) {
+				backlog.Updates = append(backlog.Updates, u)
+			}
+		}
+		backlog.Truncated = truncated
+	}
+	cm.mu.Unlock()
+	cm.reportDrops(drops)
+	return sub, backlog
+}
+
+// SetTopics replaces the topic patterns of a live subscription. Updates
+// published afterwards are filtered by the new patterns.
+func (cm *ClientManager) SetTopics(sub *Subscription, topics ...string) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
-	ch := make(chan string, 1) // Buffered channel to avoid deadlocks
-	cm.clients[clientID] = ch
-	return ch
+	sub.topics = append([]string(nil), topics...)
+}
+
+// Topics returns the subscription's topic patterns; empty means every topic.
+func (cm *ClientManager) Topics(sub *Subscription) []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return append([]string(nil), sub.topics...)
 }
 
-func (cm *ClientManager) DeregisterClient(clientID string) {
+// Unsubscribe closes and removes a subscription. It is safe to call more than
+// once and after the subscription was dropped as a slow consumer.
+func (cm *ClientManager) Unsubscribe(sub *Subscription) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
-	if ch, ok := cm.clients[clientID]; ok {
-		close(ch)
-		delete(cm.clients, clientID)
+	cm.removeLocked(sub)
+}
+
+func (cm *ClientManager) removeLocked(sub *Subscription) {
+	subs, ok := cm.clients[sub.ClientID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub.ID]; !ok {
+		return
+	}
+	close(sub.ch)
+	delete(subs, sub.ID)
+	if len(subs) == 0 {
+		delete(cm.clients, sub.ClientID)
+		cm.scheduleLeaveLocked(sub.ClientID)
 	}
 }
 
-func (cm *ClientManager) BroadcastUpdate(update string) {
+// SetClientBuffer overrides the buffer configuration for clientID's future
+// subscriptions; existing ones keep theirs. A zero BufferConfig removes the
+// override.
+func (cm *ClientManager) SetClientBuffer(clientID string, cfg BufferConfig) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cfg == (BufferConfig{}) {
+		delete(cm.clientBuffers, clientID)
+		return
+	}
+	cm.clientBuffers[clientID] = cfg
+}
+
+// Dropped returns how many updates clientID has lost to overflow policies,
+// over all of its subscriptions past and present.
+func (cm *ClientManager) Dropped(clientID string) uint64 {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.dropped[clientID]
+}
+
+// DroppedCounts returns the per-client drop counters for every client that
+// has lost updates.
+func (cm *ClientManager) DroppedCounts() map[string]uint64 {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
-	for _, ch := range cm.clients {
+	counts := make(map[string]uint64, len(cm.dropped))
+	for id, n := range cm.dropped {
+		counts[id] = n
+	}
+	return counts
+}
+
+// SubscriptionDropped returns how many updates sub has lost.
+func (cm *ClientManager) SubscriptionDropped(sub *Subscription) uint64 {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return sub.dropped
+}
+
+// SubscriptionCount returns how many subscriptions clientID currently holds.
+func (cm *ClientManager) SubscriptionCount(clientID string) int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return len(cm.clients[clientID])
+}
+
+// BroadcastUpdate publishes an update without a topic. It reaches only
+// subscriptions that did not ask for specific topics.
+func (cm *ClientManager) BroadcastUpdate(update string) {
+	cm.Publish("", update)
+}
+
+// Publish appends an update to the log and delivers it to every subscription
+// whose topic patterns match topic.
+func (cm *ClientManager) Publish(topic, data string) {
+	cm.mu.Lock()
+	drops := cm.publishLocked(nil, topic, data)
+	cm.mu.Unlock()
+	cm.reportDrops(drops)
+}
+
+// PublishBatch publishes msgs in order under a single lock, so a client that
+// resumes mid-batch sees either none or all of it in its backlog. Messages
+// with an ID keep it (see UpdateLog.AppendAt); one not newer than the log
+// head was already published and is skipped.
+func (cm *ClientManager) PublishBatch(msgs []Message) {
+	var drops []Drop
+	cm.mu.Lock()
+	for _, m := range msgs {
+		if m.ID == 0 {
+			drops = cm.publishLocked(drops, m.Topic, m.Data)
+		} else if u, ok := cm.log.AppendAt(m.ID, m.Topic, m.Data); ok {
+			drops = cm.deliverLocked(drops, u, matchAny)
+		}
+	}
+	cm.mu.Unlock()
+	cm.reportDrops(drops)
+}
+
+func (cm *ClientManager) reportDrops(drops []Drop) {
+	if cm.onDrop == nil {
+		return
+	}
+	for _, d := range drops {
+		cm.onDrop(d)
+	}
+}
+
+// publishLocked appends the update and delivers it, returning drops with any
+// losses appended.
+func (cm *ClientManager) publishLocked(drops []Drop, topic, data string) []Drop {
+	return cm.deliverLocked(drops, cm.log.Append(topic, data), matchAny)
+}
+
+// deliverLocked hands u to every subscription whose patterns match reports
+// as wanting it.
+func (cm *ClientManager) deliverLocked(drops []Drop, u Update, match func(patterns []string, topic string) bool) []Drop {
+	for _, subs := range cm.clients {
+		for _, sub := range subs {
+			if !match(sub.topics, u.Topic) {
+				continue
+			}
+			select {
+			case sub.ch <- u:
+				// Update sent successfully
+				continue
+			default:
+			}
+
+			d := Drop{ClientID: sub.ClientID, SubscriptionID: sub.ID, Policy: sub.policy}
+			switch sub.policy {
+			case DropNewest:
+				d.Updates = []Update{u}
+			case DropOldest:
+				d.Updates = evictOldest(sub.ch, u)
+			case Coalesce:
+				d.Updates = coalesce(sub.ch, u)
+			default:
+				// The client reconnects with its last seen ID and catches up
+				// from the log, so nothing is lost unless the log wraps first.
+				d.Updates = []Update{u}
+				d.Disconnected = true
+				cm.removeLocked(sub)
+			}
+			sub.dropped += uint64(len(d.Updates))
+			cm.dropped[sub.ClientID] += uint64(len(d.Updates))
+			drops = append(drops, d)
+		}
+	}
+	return drops
+}
+
+// evictOldest discards queued updates until u fits, returning what was
+// discarded. The reader may be receiving concurrently, so it can take fewer
+// evictions than expected.
+func evictOldest(ch chan Update, u Update) []Update {
+	var evicted []Update
+	for {
+		select {
+		case ch <- u:
+			return evicted
+		default:
+		}
+		select {
+		case old := <-ch:
+			evicted = append(evicted, old)
+		default:
+		}
+	}
+}
+
+// coalesce replaces the queue with the newest update per topic, keeping the
+// order in which each topic's newest update was published, then enqueues u.
+// It falls back to evictOldest when no two queued updates share a topic.
+func coalesce(ch chan Update, u Update) []Update {
+	var queued []Update
+drain:
+	for {
+		select {
+		case q := <-ch:
+			queued = append(queued, q)
+		default:
+			break drain
+		}
+	}
+	queued = append(queued, u)
+
+	newest := make(map[string]int, len(queued)) // Topic -> index of newest update
+	for i, q := range queued {
+		newest[q.Topic] = i
+	}
+	var kept, discarded []Update
+	for i, q := range queued {
+		if newest[q.Topic] == i {
+			kept = append(kept, q)
+		} else {
+			discarded = append(discarded, q)
+		}
+	}
+
+	for _, q := range kept {
 		select {
-		case ch <- update:
-			// Update sent successfully
+		case ch <- q:
 		default:
-			// Client channel is full, skip (or handle error/logging)
+			// Nothing to merge; only this goroutine sends, so evicting is
+			// guaranteed to make room.
+			discarded = append(discarded, evictOldest(ch, q)...)
 		}
 	}
+	return discarded
 }
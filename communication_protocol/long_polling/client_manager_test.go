@@ -1,25 +1,27 @@
 package long_polling
 
 import (
+	"slices"
 	"testing"
 	"time"
 )
 
-// Test that registering and deregistering a client does not cause panics,
-// and that broadcasting after deregistration does not try to send to a closed channel.
-func TestRegisterAndDeregisterClient(t *testing.T) {
+// Test that subscribing and unsubscribing a client does not cause panics,
+// and that broadcasting after unsubscribing does not try to send to a closed channel.
+func TestSubscribeAndUnsubscribeClient(t *testing.T) {
 	cm := NewClientManager()
 
-	ch := cm.RegisterClient("client-1")
-	if ch == nil {
-		t.Fatalf("expected non-nil channel from RegisterClient")
+	sub, _ := cm.Subscribe("client-1", 0)
+	if sub == nil || sub.Updates() == nil {
+		t.Fatalf("expected non-nil subscription from Subscribe")
 	}
 
-	// Deregister should close and remove the channel from the manager.
+	// Unsubscribe should close and remove the channel from the manager.
 	// If it were still in the map, BroadcastUpdate would panic when sending to a closed channel.
-	cm.DeregisterClient("client-1")
+	cm.Unsubscribe(sub)
 
-	// This should not panic.
+	// Neither of these should panic.
+	cm.Unsubscribe(sub)
 	cm.BroadcastUpdate("test-update")
 }
 
@@ -27,25 +29,214 @@ func TestRegisterAndDeregisterClient(t *testing.T) {
 func TestBroadcastUpdateToAllClients(t *testing.T) {
 	cm := NewClientManager()
 
-	c1 := cm.RegisterClient("c1")
-	c2 := cm.RegisterClient("c2")
+	c1, _ := cm.Subscribe("c1", 0)
+	c2, _ := cm.Subscribe("c2", 0)
 
 	msg := "hello"
 	cm.BroadcastUpdate(msg)
 
-	assertReceived := func(name string, ch chan string) {
-		t.Helper()
+	assertReceived(t, "c1", c1, msg)
+	assertReceived(t, "c2", c2, msg)
+}
+
+// Test that two subscriptions with the same clientID both receive updates,
+// and that unsubscribing one leaves the other open.
+func TestMultipleSubscriptionsPerClient(t *testing.T) {
+	cm := NewClientManager()
+
+	tab1, _ := cm.Subscribe("same-client", 0)
+	tab2, _ := cm.Subscribe("same-client", 0)
+	if tab1.ID == tab2.ID {
+		t.Fatalf("expected unique subscription IDs, both got %d", tab1.ID)
+	}
+
+	cm.BroadcastUpdate("both")
+	assertReceived(t, "tab1", tab1, "both")
+	assertReceived(t, "tab2", tab2, "both")
+
+	cm.Unsubscribe(tab1)
+	if _, ok := <-tab1.Updates(); ok {
+		t.Fatalf("expected tab1 channel to be closed")
+	}
+	if n := cm.SubscriptionCount("same-client"); n != 1 {
+		t.Fatalf("expected 1 remaining subscription, got %d", n)
+	}
+
+	cm.BroadcastUpdate("only-tab2")
+	assertReceived(t, "tab2", tab2, "only-tab2")
+}
+
+// Test that a subscription created with a last seen ID gets the retained
+// updates it missed, and then receives new broadcasts with increasing IDs.
+func TestSubscribeResumesFromHistory(t *testing.T) {
+	cm := NewClientManager()
+
+	cm.BroadcastUpdate("one")
+	cm.BroadcastUpdate("two")
+	cm.BroadcastUpdate("three")
+
+	sub, backlog := cm.Subscribe("s1", 1)
+	defer cm.Unsubscribe(sub)
+	missed := backlog.Updates
+
+	if len(missed) != 2 || missed[0].Data != "two" || missed[1].Data != "three" {
+		t.Fatalf("expected to resume with [two three], got %+v", missed)
+	}
+
+	cm.BroadcastUpdate("four")
+	select {
+	case u := <-sub.Updates():
+		if u.Data != "four" || u.ID != missed[1].ID+1 {
+			t.Fatalf("expected update four with ID %d, got %+v", missed[1].ID+1, u)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("subscription did not receive broadcasted message")
+	}
+}
+
+func assertReceived(t *testing.T, name string, sub *Subscription, want string) {
+	t.Helper()
+	select {
+	case got := <-sub.Updates():
+		if got.Data != want {
+			t.Fatalf("%s: expected %q, got %q", name, want, got.Data)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("%s: did not receive broadcasted message", name)
+	}
+}
+
+// Test that subscriptions with topic patterns only receive matching updates,
+// both live and when resuming from the log.
+func TestPublishFiltersByTopic(t *testing.T) {
+	cm := NewClientManager()
+
+	cm.Publish("payments.created", "p0")
+	cm.Publish("orders.created", "o0")
+
+	orders, backlog := cm.Subscribe("orders-client", 1, "orders.*")
+	defer cm.Unsubscribe(orders)
+	everything, _ := cm.Subscribe("all-client", 0)
+	defer cm.Unsubscribe(everything)
+
+	if len(backlog.Updates) != 1 || backlog.Updates[0].Data != "o0" {
+		t.Fatalf("expected backlog [o0], got %+v", backlog.Updates)
+	}
+	if backlog.Cursor != 2 {
+		t.Fatalf("expected cursor at log head 2, got %d", backlog.Cursor)
+	}
+
+	cm.Publish("payments.refunded", "p1")
+	cm.Publish("orders.paid", "o1")
+
+	assertReceived(t, "orders", orders, "o1")
+	assertReceived(t, "everything", everything, "p1")
+	assertReceived(t, "everything", everything, "o1")
+
+	cm.SetTopics(orders, "payments.#")
+	cm.Publish("payments.created", "p2")
+	assertReceived(t, "orders after SetTopics", orders, "p2")
+}
+
+// drain returns the data of every update queued on sub.
+func drain(sub *Subscription) []string {
+	var got []string
+	for {
 		select {
-		case got := <-ch:
-			if got != msg {
-				t.Fatalf("%s: expected %q, got %q", name, msg, got)
+		case u, ok := <-sub.Updates():
+			if !ok {
+				return got
 			}
-		case <-time.After(500 * time.Millisecond):
-			t.Fatalf("%s: did not receive broadcasted message", name)
+			got = append(got, u.Data)
+		default:
+			return got
 		}
 	}
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	var drops []Drop
+	cm := NewClientManager(
+		WithBuffer(BufferConfig{Size: 2, Policy: DropOldest}),
+		WithDropHook(func(d Drop) { drops = append(drops, d) }),
+	)
+	cm.SetClientBuffer("newest", BufferConfig{Size: 2, Policy: DropNewest})
+	cm.SetClientBuffer("slow", BufferConfig{Size: 2, Policy: Disconnect})
+
+	oldest, _ := cm.Subscribe("oldest", 0)
+	newest, _ := cm.Subscribe("newest", 0)
+	slow, _ := cm.Subscribe("slow", 0)
+
+	cm.PublishBatch([]Message{{Data: "1"}, {Data: "2"}, {Data: "3"}})
+
+	if got := drain(oldest); !slices.Equal(got, []string{"2", "3"}) {
+		t.Fatalf("drop-oldest: expected [2 3], got %v", got)
+	}
+	if got := drain(newest); !slices.Equal(got, []string{"1", "2"}) {
+		t.Fatalf("drop-newest: expected [1 2], got %v", got)
+	}
+	if got := drain(slow); !slices.Equal(got, []string{"1", "2"}) {
+		t.Fatalf("disconnect: expected [1 2] then close, got %v", got)
+	}
+	if _, ok := <-slow.Updates(); ok || cm.SubscriptionCount("slow") != 0 {
+		t.Fatalf("expected the slow subscription to be removed")
+	}
 
-	assertReceived("c1", c1)
-	assertReceived("c2", c2)
+	for _, id := range []string{"oldest", "newest", "slow"} {
+		if n := cm.Dropped(id); n != 1 {
+			t.Fatalf("%s: expected 1 dropped, got %d", id, n)
+		}
+	}
+	if n := cm.SubscriptionDropped(oldest); n != 1 {
+		t.Fatalf("expected subscription counter 1, got %d", n)
+	}
+	if len(drops) != 3 {
+		t.Fatalf("expected 3 drop events, got %+v", drops)
+	}
+	for _, d := range drops {
+		if d.Disconnected != (d.ClientID == "slow") {
+			t.Fatalf("unexpected Disconnected flag in %+v", d)
+		}
+	}
 }
 
+func TestCoalesceKeepsNewestPerTopic(t *testing.T) {
+	cm := NewClientManager(WithBuffer(BufferConfig{Size: 3, Policy: Coalesce}))
+	sub, _ := cm.Subscribe("c", 0, "prices.*")
+
+	cm.PublishBatch([]Message{
+		{Topic: "prices.btc", Data: "btc-1"},
+		{Topic: "prices.eth", Data: "eth-1"},
+		{Topic: "prices.btc", Data: "btc-2"},
+		{Topic: "prices.eth", Data: "eth-2"}, // Buffer full: merge
+	})
+	if got := drain(sub); !slices.Equal(got, []string{"btc-2", "eth-2"}) {
+		t.Fatalf("expected [btc-2 eth-2], got %v", got)
+	}
+	if n := cm.Dropped("c"); n != 2 {
+		t.Fatalf("expected 2 coalesced away, got %d", n)
+	}
+
+	// Distinct topics cannot be merged, so the oldest is evicted.
+	cm.PublishBatch([]Message{
+		{Topic: "prices.a", Data: "a"},
+		{Topic: "prices.b", Data: "b"},
+		{Topic: "prices.c", Data: "c"},
+		{Topic: "prices.d", Data: "d"},
+	})
+	if got := drain(sub); !slices.Equal(got, []string{"b", "c", "d"}) {
+		t.Fatalf("expected [b c d], got %v", got)
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, p := range []OverflowPolicy{Disconnect, DropOldest, DropNewest, Coalesce} {
+		got, err := ParseOverflowPolicy(p.String())
+		if err != nil || got != p {
+			t.Fatalf("%v: round trip gave %v (%v)", p, got, err)
+		}
+	}
+	if _, err := ParseOverflowPolicy("bogus"); err == nil {
+		t.Fatalf("expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,249 @@
+package long_polling
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Bus fans batches out to every replica. Each replica holds its own Bus value;
+// Publish sends to all of them (including the sender), and Next receives
+// what was published, in order.
+type Bus interface {
+	UpdateSource
+	Publish(ctx context.Context, msgs []Message) error
+}
+
+// LeaderLock is a lease held by at most one replica at a time.
+type LeaderLock interface {
+	// Acquire tries once to take the lease and reports whether it is now held.
+	Acquire(ctx context.Context) (bool, error)
+	// Renew extends a held lease; false means it was lost to another replica.
+	Renew(ctx context.Context) (bool, error)
+	// Release gives the lease up if it is still held.
+	Release(ctx context.Context) error
+}
+
+// ClusterState is shared by every replica and outlives any one leader.
+type ClusterState interface {
+	// Reserve allocates n consecutive sequence IDs and returns the last one.
+	Reserve(ctx context.Context, n int) (uint64, error)
+	// Position returns the source position last saved, or "" if none was.
+	Position(ctx context.Context) (string, error)
+	// SavePosition records how far the source has been published.
+	SavePosition(ctx context.Context, pos string) error
+}
+
+// ClusterNotifier lets several long-polling replicas share one update source.
+// Every replica delivers what arrives on the bus to its local ClientManager;
+// only the replica holding the leader lock reads the source and republishes
+// it on the bus, so the source sees a single reader however many replicas run.
+//
+// The leader stamps each message with an ID reserved from the shared state
+// before publishing, and every replica logs it under that ID, so a resume
+// cursor means the same thing on every replica. IDs are reserved before a
+// batch is sent, so one that never made it out leaves a hole that clients
+// see as a truncated backlog, never a reused ID. Nothing else should publish
+// to a replica's ClientManager, or its log would disagree with the others.
+//
+// If the source is a Checkpointer, the leader saves its position after each
+// batch and a new leader resumes from it. A leader that fails between
+// publishing and saving causes that batch to be published again. Other
+// sources start from wherever a new leader's source starts, typically "now",
+// so updates produced during a failover (at most the lock TTL) can be missed.
+// A source that is a Stopper, such as a KafkaSource, is stopped whenever the
+// replica steps down, so it never holds on to what the new leader reads.
+type ClusterNotifier struct {
+	source        UpdateSource
+	bus           Bus
+	lock          LeaderLock
+	state         ClusterState
+	local         *UpdateNotifier // Bus -> local ClientManager
+	leaseInterval time.Duration   // How often to try to acquire or renew the lock
+	retryInterval time.Duration
+	stopChan      chan struct{}
+}
+
+// NewClusterNotifier creates a ClusterNotifier. leaseInterval should be well
+// below the lock's TTL (a third is typical) so renewals happen in time.
+func NewClusterNotifier(cm *ClientManager, source UpdateSource, bus Bus, lock LeaderLock, state ClusterState, leaseInterval time.Duration) *ClusterNotifier {
+	return &ClusterNotifier{
+		source:        source,
+		bus:           bus,
+		lock:          lock,
+		state:         state,
+		local:         NewUpdateNotifier(cm, bus),
+		leaseInterval: leaseInterval,
+		retryInterval: 5 * time.Second,
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// Start runs until Stop is called, campaigning for leadership and relaying
+// the source onto the bus while leader.
+func (cn *ClusterNotifier) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-cn.stopChan
+		cancel()
+	}()
+
+	go cn.local.Start()
+	defer cn.local.Stop()
+
+	ticker := time.NewTicker(cn.leaseInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := cn.lock.Acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error acquiring leader lock: %v", err)
+		}
+		if ok {
+			log.Println("Became update leader")
+			cn.lead(ctx)
+			log.Println("No longer update leader")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stop halts the notifier, releasing leadership if held.
+func (cn *ClusterNotifier) Stop() {
+	close(cn.stopChan)
+}
+
+// lead relays the source onto the bus until the lock is lost or ctx is done.
+func (cn *ClusterNotifier) lead(ctx context.Context) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := cn.lock.Release(releaseCtx); err != nil {
+			log.Printf("Error releasing leader lock: %v", err)
+		}
+	}()
+
+	if stopper, ok := cn.source.(Stopper); ok {
+		// Runs before the lock is released, so the source is free by the
+		// time another replica can lead.
+		defer func() {
+			if err := stopper.Stop(); err != nil {
+				log.Printf("Error stopping update source: %v", err)
+			}
+		}()
+	}
+
+	go func() {
+		ticker := time.NewTicker(cn.leaseInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ok, err := cn.lock.Renew(leadCtx)
+				if err != nil || !ok {
+					if err != nil && leadCtx.Err() == nil {
+						log.Printf("Error renewing leader lock: %v", err)
+					}
+					cancel() // Step down; someone else may already be leader
+					return
+				}
+			case <-leadCtx.Done():
+				return
+			}
+		}
+	}()
+
+	checkpointer, _ := cn.source.(Checkpointer)
+	if checkpointer != nil {
+		if !cn.retry(leadCtx, "resuming from the saved source position", func() error {
+			pos, err := cn.state.Position(leadCtx)
+			if err != nil || pos == "" {
+				return err
+			}
+			return checkpointer.Resume(pos)
+		}) {
+			return
+		}
+	}
+
+	for {
+		batch, err := cn.source.Next(leadCtx)
+		if leadCtx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Error reading updates: %v", err)
+			if len(batch) == 0 {
+				if !cn.wait(leadCtx) {
+					return
+				}
+				continue
+			}
+		}
+
+		if !cn.retry(leadCtx, "reserving update IDs", func() error {
+			last, err := cn.state.Reserve(leadCtx, len(batch))
+			if err != nil {
+				return err
+			}
+			first := last - uint64(len(batch)) + 1
+			for i := range batch {
+				batch[i].ID = first + uint64(i)
+			}
+			return nil
+		}) {
+			return
+		}
+		if !cn.retry(leadCtx, "publishing updates to bus", func() error {
+			return cn.bus.Publish(leadCtx, batch)
+		}) {
+			return
+		}
+		if acker, ok := cn.source.(Acker); ok {
+			acker.Ack()
+		}
+		if checkpointer != nil {
+			if err := cn.state.SavePosition(leadCtx, checkpointer.Checkpoint()); err != nil && leadCtx.Err() == nil {
+				// The next batch saves a newer position; until then a new
+				// leader would publish this batch again.
+				log.Printf("Error saving source position: %v", err)
+			}
+		}
+	}
+}
+
+// retry calls fn until it succeeds, waiting the retry interval after each
+// failure, and reports false if ctx ended first.
+func (cn *ClusterNotifier) retry(ctx context.Context, what string, fn func() error) bool {
+	for {
+		err := fn()
+		if err == nil {
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		log.Printf("Error %s: %v", what, err)
+		if !cn.wait(ctx) {
+			return false
+		}
+	}
+}
+
+// wait sleeps for the retry interval and reports false if ctx ended first.
+func (cn *ClusterNotifier) wait(ctx context.Context) bool {
+	select {
+	case <-time.After(cn.retryInterval):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,225 @@
+package long_polling
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memoryHub connects in-process buses the way a Redis channel connects replicas.
+type memoryHub struct {
+	mu   sync.Mutex
+	subs []*MemorySource
+}
+
+type memoryBus struct {
+	*MemorySource
+	hub *memoryHub
+}
+
+func (h *memoryHub) join() *memoryBus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	src := NewMemorySource()
+	h.subs = append(h.subs, src)
+	return &memoryBus{MemorySource: src, hub: h}
+}
+
+func (b *memoryBus) Publish(_ context.Context, msgs []Message) error {
+	b.hub.mu.Lock()
+	defer b.hub.mu.Unlock()
+	for _, s := range b.hub.subs {
+		s.Push(msgs...)
+	}
+	return nil
+}
+
+// memoryLock is a LeaderLock shared by replicas through a common holder.
+type memoryLock struct {
+	holder *atomic.Pointer[memoryLock]
+}
+
+func (l *memoryLock) Acquire(context.Context) (bool, error) {
+	return l.holder.CompareAndSwap(nil, l), nil
+}
+
+func (l *memoryLock) Renew(context.Context) (bool, error) {
+	return l.holder.Load() == l, nil
+}
+
+func (l *memoryLock) Release(context.Context) error {
+	l.holder.CompareAndSwap(l, nil)
+	return nil
+}
+
+// memoryState is a ClusterState shared by replicas in the same process.
+type memoryState struct {
+	mu       sync.Mutex
+	lastID   uint64
+	position string
+}
+
+func (s *memoryState) Reserve(_ context.Context, n int) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID += uint64(n)
+	return s.lastID, nil
+}
+
+func (s *memoryState) Position(context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.position, nil
+}
+
+func (s *memoryState) SavePosition(_ context.Context, pos string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.position = pos
+	return nil
+}
+
+// countingSource records how many times it is read from.
+type countingSource struct {
+	*MemorySource
+	reads atomic.Int32
+}
+
+func (s *countingSource) Next(ctx context.Context) ([]Message, error) {
+	s.reads.Add(1)
+	return s.MemorySource.Next(ctx)
+}
+
+// Test that with two replicas only the leader reads the source, and both
+// replicas' clients receive what it read.
+func TestClusterNotifierSingleReaderFanOut(t *testing.T) {
+	hub := &memoryHub{}
+	holder := &atomic.Pointer[memoryLock]{}
+	source := &countingSource{MemorySource: NewMemorySource()}
+	idle := &countingSource{MemorySource: NewMemorySource()} // Would be another replica's connection to the same DB
+
+	state := &memoryState{}
+	cm1, cm2 := NewClientManager(), NewClientManager()
+	sub1, _ := cm1.Subscribe("c1", 0)
+	sub2, _ := cm2.Subscribe("c2", 0)
+
+	n1 := NewClusterNotifier(cm1, source, hub.join(), &memoryLock{holder: holder}, state, 10*time.Millisecond)
+	go n1.Start()
+	defer n1.Stop()
+	// Let the first replica win the election before the second starts.
+	deadline := time.Now().Add(time.Second)
+	for holder.Load() == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	n2 := NewClusterNotifier(cm2, idle, hub.join(), &memoryLock{holder: holder}, state, 10*time.Millisecond)
+	go n2.Start()
+	defer n2.Stop()
+
+	source.Push(Message{Topic: "orders.created", Data: "o1"})
+
+	for name, sub := range map[string]*Subscription{"replica1": sub1, "replica2": sub2} {
+		select {
+		case u := <-sub.Updates():
+			if u.Data != "o1" {
+				t.Fatalf("%s: expected o1, got %q", name, u.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: did not receive update", name)
+		}
+	}
+	if n := idle.reads.Load(); n != 0 {
+		t.Fatalf("expected the follower never to read its source, got %d reads", n)
+	}
+}
+
+// checkpointSource is a MemorySource whose position is the number of
+// messages it has returned, offset by where it was resumed.
+type checkpointSource struct {
+	*MemorySource
+	mu  sync.Mutex
+	pos int
+}
+
+func (s *checkpointSource) Next(ctx context.Context) ([]Message, error) {
+	msgs, err := s.MemorySource.Next(ctx)
+	s.mu.Lock()
+	s.pos += len(msgs)
+	s.mu.Unlock()
+	return msgs, err
+}
+
+func (s *checkpointSource) Checkpoint() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strconv.Itoa(s.pos)
+}
+
+func (s *checkpointSource) Resume(pos string) error {
+	n, err := strconv.Atoi(pos)
+	s.mu.Lock()
+	s.pos = n
+	s.mu.Unlock()
+	return err
+}
+
+// Test that every replica logs an update under the ID the leader reserved, so
+// cursors carry over between replicas, and that the leader resumes its source
+// from the shared position and saves the new one.
+func TestClusterNotifierSharedIDsAndPosition(t *testing.T) {
+	hub := &memoryHub{}
+	holder := &atomic.Pointer[memoryLock]{}
+	state := &memoryState{lastID: 100, position: "7"} // Left by a previous leader
+	source := &checkpointSource{MemorySource: NewMemorySource()}
+
+	cm1, cm2 := NewClientManager(), NewClientManager()
+	cm2.Publish("", "local") // A replica's own log must not shift the shared IDs
+	sub1, _ := cm1.Subscribe("c1", 0)
+	sub2, _ := cm2.Subscribe("c2", 0)
+
+	n1 := NewClusterNotifier(cm1, source, hub.join(), &memoryLock{holder: holder}, state, 10*time.Millisecond)
+	go n1.Start()
+	defer n1.Stop()
+	deadline := time.Now().Add(time.Second)
+	for holder.Load() == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	n2 := NewClusterNotifier(cm2, NewMemorySource(), hub.join(), &memoryLock{holder: holder}, state, 10*time.Millisecond)
+	go n2.Start()
+	defer n2.Stop()
+
+	source.Push(Message{Data: "a"}, Message{Data: "b"})
+
+	for name, sub := range map[string]*Subscription{"replica1": sub1, "replica2": sub2} {
+		for _, want := range []Update{{ID: 101, Data: "a"}, {ID: 102, Data: "b"}} {
+			select {
+			case u := <-sub.Updates():
+				if u != want {
+					t.Fatalf("%s: expected %+v, got %+v", name, want, u)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s: did not receive %q", name, want.Data)
+			}
+		}
+	}
+
+	// The position is saved after the batch is published.
+	deadline = time.Now().Add(time.Second)
+	for {
+		if pos, _ := state.Position(context.Background()); pos == "9" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected position 9 (resumed at 7, plus 2), got %q", state.position)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A client that moves to the other replica resumes with the same cursor.
+	_, backlog := cm2.Subscribe("c1", 101)
+	if len(backlog.Updates) != 1 || backlog.Updates[0].Data != "b" {
+		t.Fatalf("expected [b] after cursor 101 on replica2, got %+v", backlog.Updates)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/poeticcode01/poc/communication_protocol/long_polling"
+	"github.com/poeticcode01/poc/communication_protocol/long_polling/auth"
+)
+
+// authenticator is nil when authentication is disabled, in which case
+// clients identify themselves with ?clientID= and may subscribe to anything.
+var authenticator auth.Authenticator
+
+type authConfig struct {
+	kind       string // none, tokens or jwt
+	tokensFile string
+	jwtSecret  string
+	jwksFile   string
+	issuer     string
+	audience   string
+	noExpiry   bool // Accept JWTs without an exp claim
+}
+
+// openAuthenticator builds the Authenticator selected by cfg.kind.
+func openAuthenticator(cfg authConfig) (auth.Authenticator, error) {
+	switch cfg.kind {
+	case "", "none":
+		return nil, nil
+	case "tokens":
+		return auth.LoadStaticTokens(cfg.tokensFile)
+	case "jwt":
+		j := &auth.JWT{Issuer: cfg.issuer, Audience: cfg.audience, AllowNoExpiry: cfg.noExpiry}
+		switch {
+		case cfg.jwksFile != "":
+			keys, err := auth.NewJWKSFile(cfg.jwksFile)
+			if err != nil {
+				return nil, err
+			}
+			j.Keys = keys
+		case cfg.jwtSecret != "":
+			j.Keys = auth.HMACKey(cfg.jwtSecret)
+		default:
+			return nil, fmt.Errorf("-auth=jwt needs -jwks-file or -jwt-secret")
+		}
+		return j, nil
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", cfg.kind)
+	}
+}
+
+// withAuth authenticates requests to h when authentication is enabled.
+func withAuth(h http.HandlerFunc) http.Handler {
+	if authenticator == nil {
+		return h
+	}
+	return auth.Middleware(authenticator, h)
+}
+
+// presenceScope must be granted to list online clients or subscribe to
+// presence events while authentication is enabled.
+const presenceScope = "presence"
+
+// errPresenceScope is returned to authenticated clients without presenceScope.
+var errPresenceScope = fmt.Errorf("the %q scope is required for presence", presenceScope)
+
+// canSeePresence reports whether r may list online clients and subscribe to
+// presence events: always without authentication, otherwise only with
+// presenceScope.
+func canSeePresence(r *http.Request) bool {
+	id, ok := auth.FromContext(r.Context())
+	return !ok || id.HasScope(presenceScope)
+}
+
+// authorizePresenceTopics refuses a subscription to the presence topic from
+// a client that may not see presence.
+func authorizePresenceTopics(r *http.Request, topics []string) error {
+	if slices.Contains(topics, long_polling.PresenceTopic) && !canSeePresence(r) {
+		return errPresenceScope
+	}
+	return nil
+}
+
+// clientIdentity returns who r is for and the topic patterns it may subscribe
+// to. With authentication the ID comes from the token and a
+// conflicting ?clientID= is refused; without it ?clientID= is required. On
+// failure status is the HTTP status to reply with.
+func clientIdentity(r *http.Request) (clientID string, allowed []string, status int, err error) {
+	requested := r.URL.Query().Get("clientID")
+	if id, ok := auth.FromContext(r.Context()); ok {
+		if requested != "" && requested != id.ClientID {
+			return "", nil, http.StatusForbidden, fmt.Errorf("token is not valid for clientID %q", requested)
+		}
+		return id.ClientID, id.Topics, 0, nil
+	}
+	if requested == "" {
+		return "", nil, http.StatusBadRequest, fmt.Errorf("clientID is required")
+	}
+	return requested, anyTopic, 0, nil
+}
+
+// anyTopic allows every topic to clients when authentication is disabled.
+var anyTopic = []string{"#"}
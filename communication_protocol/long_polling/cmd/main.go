@@ -1,12 +1,17 @@
 package main
 
 import (
-	"database/sql"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/redis/go-redis/v9"
+
 	long_polling "github.com/poeticcode01/poc/communication_protocol/long_polling"
 
 	_ "github.com/lib/pq" // For PostgreSQL example, replace with your database driver
@@ -15,48 +20,293 @@ import (
 // clientManager is shared across all long polling handlers
 var clientManager = long_polling.NewClientManager()
 
+var (
+	// defaultPollTimeout is used when a poll does not pass ?timeout=.
+	defaultPollTimeout = 30 * time.Second
+	// maxPollTimeout caps client-supplied timeouts.
+	maxPollTimeout = 2 * time.Minute
+)
+
+// pollResponse is the JSON body returned by /updates.
+type pollResponse struct {
+	Updates   []long_polling.Update `json:"updates"`
+	Cursor    uint64                `json:"cursor"`              // Pass back as ?since= (or If-None-Match) on the next poll
+	Truncated bool                  `json:"truncated,omitempty"` // Some updates after the cursor were no longer retained
+}
+
+// longPollingHandler waits for updates for a client and returns them as a
+// pollResponse. Clients resume with ?since=<cursor> (or by sending the
+// previous ETag in If-None-Match), may restrict delivery with one or more
+// ?topic= patterns, and may pick a ?timeout= up to maxPollTimeout.
+//
+// Status codes: 200 with updates; 204 when the timeout passes with nothing new
+// (304 instead if the request was conditional on If-None-Match), with the
+// cursor to resume from in X-Cursor and "X-Truncated: true" if the cursor
+// passed in was no longer valid; 400 for bad parameters; 503 if the
+// subscription was dropped as a slow consumer.
 func longPollingHandler(w http.ResponseWriter, r *http.Request) {
-	clientID := r.URL.Query().Get("clientID")
-	if clientID == "" {
-		http.Error(w, "clientID is required", http.StatusBadRequest)
+	clientID, allowed, status, err := clientIdentity(r)
+	if err != nil {
+		writeJSONError(w, status, err.Error())
 		return
 	}
 
-	clientChan := clientManager.RegisterClient(clientID)
-	defer clientManager.DeregisterClient(clientID)
+	since, conditional, err := parseCursor(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	timeout, err := parseTimeout(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	topics, err := parseTopics(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if topics, err = long_polling.AuthorizeTopics(allowed, topics); err != nil {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err := authorizePresenceTopics(r, topics); err != nil {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	sub, backlog := clientManager.Subscribe(clientID, since, topics...)
+	defer clientManager.Unsubscribe(sub)
+
+	w.Header().Set("Cache-Control", "no-store")
+	if len(backlog.Updates) > 0 {
+		writeUpdates(w, pollResponse{Updates: backlog.Updates, Cursor: backlog.Cursor, Truncated: backlog.Truncated})
+		return
+	}
 
-	timeout := time.After(30 * time.Second) // Adjust timeout as needed
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
 	select {
-	case update := <-clientChan:
-		fmt.Fprintf(w, "Update: %s", update)
-	case <-timeout:
-		fmt.Fprint(w, "Timeout: No new updates")
+	case update, ok := <-sub.Updates():
+		if !ok {
+			writeJSONError(w, http.StatusServiceUnavailable, "subscription dropped")
+			return
+		}
+		updates := []long_polling.Update{update}
+		// Return anything else that is already queued in the same response.
+	drain:
+		for {
+			select {
+			case u, ok := <-sub.Updates():
+				if !ok {
+					break drain
+				}
+				updates = append(updates, u)
+			default:
+				break drain
+			}
+		}
+		writeUpdates(w, pollResponse{Updates: updates, Cursor: updates[len(updates)-1].ID, Truncated: backlog.Truncated})
+	case <-timer.C:
+		w.Header().Set("ETag", cursorETag(backlog.Cursor))
+		w.Header().Set("X-Cursor", strconv.FormatUint(backlog.Cursor, 10))
+		if backlog.Truncated {
+			w.Header().Set("X-Truncated", "true")
+		}
+		if conditional {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
 	case <-r.Context().Done():
 		log.Printf("Client %s disconnected", clientID)
 	}
 }
 
+// presenceHandler lists online clients and their subscriptions. With
+// authentication enabled it requires presenceScope.
+func presenceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !canSeePresence(r) {
+		writeJSONError(w, http.StatusForbidden, errPresenceScope.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"clients": clientManager.Presence()})
+}
+
+// parseCursor returns the cursor to resume from: ?since= if present,
+// otherwise the ETag in If-None-Match. conditional reports the latter.
+func parseCursor(r *http.Request) (cursor uint64, conditional bool, err error) {
+	if s := r.URL.Query().Get("since"); s != "" {
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid since cursor")
+		}
+		return v, false, nil
+	}
+	if tag := r.Header.Get("If-None-Match"); tag != "" {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		v, err := strconv.ParseUint(strings.Trim(tag, `"`), 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid If-None-Match")
+		}
+		return v, true, nil
+	}
+	return 0, false, nil
+}
+
+// parseTimeout reads ?timeout= as a Go duration ("15s") or whole seconds,
+// capped at maxPollTimeout. 0 makes the poll return immediately.
+func parseTimeout(r *http.Request) (time.Duration, error) {
+	s := r.URL.Query().Get("timeout")
+	if s == "" {
+		return defaultPollTimeout, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		secs, serr := strconv.Atoi(s)
+		if serr != nil {
+			return 0, fmt.Errorf("invalid timeout %q", s)
+		}
+		d = time.Duration(secs) * time.Second
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid timeout %q", s)
+	}
+	if d > maxPollTimeout {
+		d = maxPollTimeout
+	}
+	return d, nil
+}
+
+// parseTopics returns the topic patterns from repeated ?topic= parameters.
+// No topics means the client receives every update.
+func parseTopics(r *http.Request) ([]string, error) {
+	topics := r.URL.Query()["topic"]
+	for _, t := range topics {
+		if err := long_polling.ValidateTopicPattern(t); err != nil {
+			return nil, err
+		}
+	}
+	return topics, nil
+}
+
+// writeUpdates writes a 200 pollResponse. The cursor is also sent as the
+// ETag and X-Cursor headers for clients that don't parse the body.
+func writeUpdates(w http.ResponseWriter, resp pollResponse) {
+	w.Header().Set("ETag", cursorETag(resp.Cursor))
+	w.Header().Set("X-Cursor", strconv.FormatUint(resp.Cursor, 10))
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func cursorETag(cursor uint64) string {
+	return `"` + strconv.FormatUint(cursor, 10) + `"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
 func main() {
-	// Initialize database connection
-	connStr := "user=postgres password=postgres dbname=long_polling sslmode=disable"
-	db, err := sql.Open("postgres", connStr) // Replace with your database driver and connection string
+	sourceKind := flag.String("source", "listen", "where updates come from: listen (Postgres LISTEN/NOTIFY), poll (Postgres polling), redis or kafka")
+	redisAddr := flag.String("redis-addr", "localhost:6379", "Redis address for -source=redis")
+	redisChannels := flag.String("redis-channels", "updates,orders.*", "comma-separated Redis channels or patterns for -source=redis")
+	kafkaBrokers := flag.String("kafka-brokers", "localhost:9092", "comma-separated Kafka brokers for -source=kafka")
+	kafkaTopics := flag.String("kafka-topics", "orders", "comma-separated Kafka topics for -source=kafka")
+	kafkaGroup := flag.String("kafka-group", "long-polling", "Kafka consumer group for -source=kafka")
+	cluster := flag.Bool("cluster", false, "run as one of several replicas sharing the source through a Redis leader and bus")
+	clusterRedisAddr := flag.String("cluster-redis-addr", "localhost:6379", "Redis address for -cluster")
+	flag.DurationVar(&defaultPollTimeout, "poll-timeout", defaultPollTimeout, "long-poll timeout when the client does not pass ?timeout=")
+	flag.DurationVar(&maxPollTimeout, "max-poll-timeout", maxPollTimeout, "upper bound for client-supplied ?timeout=")
+	presenceGrace := flag.Duration("presence-grace", 10*time.Second, "how long a client stays online after its last poll or stream ends (0 disables presence)")
+	bufferSize := flag.Int("buffer-size", long_polling.DefaultBufferSize, "per-subscription update buffer")
+	bufferPolicy := flag.String("buffer-policy", "disconnect", "what to do when a subscriber's buffer is full: disconnect, drop-oldest, drop-newest or coalesce")
+	authKind := flag.String("auth", "none", "client authentication: none, tokens (static bearer tokens) or jwt")
+	authTokens := flag.String("auth-tokens", "tokens.json", "JSON file mapping bearer tokens to identities for -auth=tokens")
+	jwtSecret := flag.String("jwt-secret", "", "HS256 secret for -auth=jwt")
+	jwksFile := flag.String("jwks-file", "", "JWKS file with RS256/HS256 keys for -auth=jwt")
+	jwtIssuer := flag.String("jwt-issuer", "", "required iss claim for -auth=jwt")
+	jwtAudience := flag.String("jwt-audience", "", "required aud claim for -auth=jwt")
+	jwtNoExpiry := flag.Bool("jwt-allow-no-exp", false, "accept JWTs without an exp claim for -auth=jwt")
+	flag.Parse()
+
+	var err error
+	authenticator, err = openAuthenticator(authConfig{
+		kind:       *authKind,
+		tokensFile: *authTokens,
+		jwtSecret:  *jwtSecret,
+		jwksFile:   *jwksFile,
+		issuer:     *jwtIssuer,
+		audience:   *jwtAudience,
+		noExpiry:   *jwtNoExpiry,
+	})
 	if err != nil {
-		log.Fatalf("Failed to open database connection: %v", err)
+		log.Fatalf("Failed to set up authentication: %v", err)
 	}
-	defer db.Close()
 
-	err = db.Ping()
+	policy, err := long_polling.ParseOverflowPolicy(*bufferPolicy)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Fatal(err)
+	}
+	opts := []long_polling.Option{
+		long_polling.WithBuffer(long_polling.BufferConfig{Size: *bufferSize, Policy: policy}),
+		long_polling.WithDropHook(func(d long_polling.Drop) {
+			log.Printf("Client %s (subscription %d) dropped %d update(s) [%s]", d.ClientID, d.SubscriptionID, len(d.Updates), d.Policy)
+		}),
 	}
-	log.Println("Successfully connected to database!")
+	if *presenceGrace > 0 {
+		opts = append(opts, long_polling.WithPresence(*presenceGrace))
+	}
+	clientManager = long_polling.NewClientManager(opts...)
+
+	// Open the update source
+	source, closeSource, err := openUpdateSource(sourceConfig{
+		kind:          *sourceKind,
+		postgresDSN:   "user=postgres password=postgres dbname=long_polling sslmode=disable",
+		redisAddr:     *redisAddr,
+		redisChannels: splitList(*redisChannels),
+		kafkaBrokers:  splitList(*kafkaBrokers),
+		kafkaTopics:   splitList(*kafkaTopics),
+		kafkaGroup:    *kafkaGroup,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open update source: %v", err)
+	}
+	defer closeSource()
 
 	// Start the update notifier
-	notifier := long_polling.NewUpdateNotifier(clientManager, db, 5*time.Second) // Check every 5 seconds
-	go notifier.Start()
+	if *cluster {
+		// Replicas share one source: the leader relays it to all of them over Redis.
+		rdb := redis.NewClient(&redis.Options{Addr: *clusterRedisAddr})
+		defer rdb.Close()
+		lock, err := long_polling.NewRedisLock(rdb, "", 15*time.Second)
+		if err != nil {
+			log.Fatalf("Failed to create leader lock: %v", err)
+		}
+		bus := long_polling.NewRedisBus(rdb, "")
+		defer bus.Close()
+		state := long_polling.NewRedisClusterState(rdb, "")
+		notifier := long_polling.NewClusterNotifier(clientManager, source, bus, lock, state, 5*time.Second)
+		go notifier.Start()
+	} else {
+		notifier := long_polling.NewUpdateNotifier(clientManager, source)
+		go notifier.Start()
+	}
 
-	http.HandleFunc("/updates", longPollingHandler)
+	http.Handle("/updates", withAuth(longPollingHandler))
+	http.Handle("/events", withAuth(sseHandler))
+	http.Handle("/ws", withAuth(webSocketHandler))
+	http.Handle("/presence", withAuth(presenceHandler))
 
 	log.Println("Server starting on :8080")
 	if err := http.ListenAndServe(":8080", nil); err != nil {
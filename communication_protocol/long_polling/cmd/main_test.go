@@ -1,11 +1,19 @@
 package main
 
 import (
-	"io"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/poeticcode01/poc/communication_protocol/long_polling"
+	"github.com/poeticcode01/poc/communication_protocol/long_polling/auth"
+	"github.com/poeticcode01/poc/communication_protocol/long_polling/websocket"
 )
 
 // Test that calling the /updates handler returns an update
@@ -26,14 +34,387 @@ func TestLongPollingHandlerReceivesUpdate(t *testing.T) {
 	res := w.Result()
 	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.StatusCode)
+	}
+	var resp pollResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if len(resp.Updates) != 1 || resp.Updates[0].Data != "test-update" {
+		t.Fatalf("expected one update %q, got %+v", "test-update", resp.Updates)
+	}
+	if resp.Cursor != resp.Updates[0].ID {
+		t.Fatalf("expected cursor %d, got %d", resp.Updates[0].ID, resp.Cursor)
+	}
+}
+
+// Test that updates broadcast between polls are returned immediately when the
+// client passes the cursor from its previous response.
+func TestLongPollingHandlerResumesFromCursor(t *testing.T) {
+	// First poll establishes a cursor.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		clientManager.BroadcastUpdate("before-gap")
+	}()
+	w := httptest.NewRecorder()
+	longPollingHandler(w, httptest.NewRequest("GET", "/updates?clientID=cursor-client", nil))
+	cursor := w.Result().Header.Get("X-Cursor")
+	if _, err := strconv.ParseUint(cursor, 10, 64); err != nil {
+		t.Fatalf("expected numeric X-Cursor, got %q", cursor)
+	}
+
+	// These happen while the client is not polling.
+	clientManager.BroadcastUpdate("gap-1")
+	clientManager.BroadcastUpdate("gap-2")
+
+	w = httptest.NewRecorder()
+	start := time.Now()
+	longPollingHandler(w, httptest.NewRequest("GET", "/updates?clientID=cursor-client&since="+cursor, nil))
+	if time.Since(start) > time.Second {
+		t.Fatalf("expected missed updates to be returned immediately")
+	}
+
+	var resp pollResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if len(resp.Updates) != 2 || resp.Updates[0].Data != "gap-1" || resp.Updates[1].Data != "gap-2" {
+		t.Fatalf("expected gap-1 and gap-2, got %+v", resp.Updates)
+	}
+	prev, _ := strconv.ParseUint(cursor, 10, 64)
+	if resp.Cursor != prev+2 {
+		t.Fatalf("expected cursor %d, got %d", prev+2, resp.Cursor)
+	}
+}
+
+// Test that a poll with nothing new returns 204 after the client-supplied
+// timeout, and that replaying the ETag returns 304 instead.
+func TestLongPollingHandlerTimeoutAndETag(t *testing.T) {
+	clientManager.BroadcastUpdate("etag-seed")
+
+	// Start from the current head so there is nothing to return.
+	w := httptest.NewRecorder()
+	start := time.Now()
+	longPollingHandler(w, httptest.NewRequest("GET", "/updates?clientID=etag-client&timeout=50ms", nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("expected the poll to honour the 50ms timeout")
+	}
+	etag := w.Result().Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("expected an ETag on 204")
+	}
+
+	req := httptest.NewRequest("GET", "/updates?clientID=etag-client&timeout=50ms", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	longPollingHandler(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", w.Code)
+	}
+
+	clientManager.BroadcastUpdate("etag-next")
+	req = httptest.NewRequest("GET", "/updates?clientID=etag-client&timeout=50ms", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	longPollingHandler(w, req)
+	var resp pollResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if w.Code != http.StatusOK || len(resp.Updates) != 1 || resp.Updates[0].Data != "etag-next" {
+		t.Fatalf("expected 200 with etag-next, got %d %+v", w.Code, resp.Updates)
+	}
+	if got := w.Result().Header.Get("ETag"); got == etag {
+		t.Fatalf("expected the ETag to change after an update")
+	}
+}
+
+// Test that a cursor ahead of the server's is reported as truncated, on a 204
+// as well as with the retained updates.
+func TestLongPollingHandlerCursorAhead(t *testing.T) {
+	clientManager.BroadcastUpdate("ahead-seed")
+	since := strconv.FormatUint(1<<40, 10)
+
+	w := httptest.NewRecorder()
+	longPollingHandler(w, httptest.NewRequest("GET", "/updates?clientID=ahead-client&timeout=10ms&since="+since, nil))
+	var resp pollResponse
+	if err := json.NewDecoder(w.Result().Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if w.Code != http.StatusOK || !resp.Truncated || len(resp.Updates) == 0 || resp.Cursor >= 1<<40 {
+		t.Fatalf("expected the retained updates, truncated, got %d %+v", w.Code, resp)
+	}
+
+	w = httptest.NewRecorder()
+	longPollingHandler(w, httptest.NewRequest("GET", "/updates?clientID=ahead-client&timeout=10ms&topic=ahead.none&since="+since, nil))
+	if w.Code != http.StatusNoContent || w.Result().Header.Get("X-Truncated") != "true" {
+		t.Fatalf("expected a truncated 204, got %d %v", w.Code, w.Result().Header)
+	}
+	if got := w.Result().Header.Get("X-Cursor"); got != strconv.FormatUint(resp.Cursor, 10) {
+		t.Fatalf("expected X-Cursor %d, got %q", resp.Cursor, got)
+	}
+
+	w = httptest.NewRecorder()
+	longPollingHandler(w, httptest.NewRequest("GET", "/updates?clientID=ahead-client&timeout=10ms&topic=ahead.none", nil))
+	if w.Code != http.StatusNoContent || w.Result().Header.Get("X-Truncated") != "" {
+		t.Fatalf("expected a plain 204, got %d %v", w.Code, w.Result().Header)
+	}
+}
+
+// Test that client timeouts are capped by the server maximum.
+func TestParseTimeoutBounded(t *testing.T) {
+	for q, want := range map[string]time.Duration{
+		"":      defaultPollTimeout,
+		"5":     5 * time.Second,
+		"250ms": 250 * time.Millisecond,
+		"1h":    maxPollTimeout,
+	} {
+		got, err := parseTimeout(httptest.NewRequest("GET", "/updates?timeout="+q, nil))
+		if err != nil || got != want {
+			t.Fatalf("timeout=%q: expected %v, got %v (%v)", q, want, got, err)
+		}
+	}
+	if _, err := parseTimeout(httptest.NewRequest("GET", "/updates?timeout=-1s", nil)); err == nil {
+		t.Fatalf("expected an error for a negative timeout")
+	}
+}
+
+// Test that the /events handler streams broadcasts as SSE events and that
+// reconnecting with Last-Event-ID replays the updates that were missed.
+func TestSSEHandlerStreamsAndResumes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(sseHandler))
+	defer srv.Close()
+
+	readEvent := func(r *bufio.Reader) (id, data string) {
+		t.Helper()
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read event: %v", err)
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case line == "" && data != "":
+				return id, data
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}
+
+	res, err := http.Get(srv.URL + "?clientID=sse-client")
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		clientManager.BroadcastUpdate("first")
+	}()
+	firstID, data := readEvent(bufio.NewReader(res.Body))
+	if data != "first" {
+		t.Fatalf("expected %q, got %q", "first", data)
+	}
+	res.Body.Close()
+
+	// Broadcast while disconnected, then resume from the last seen ID.
+	clientManager.BroadcastUpdate("missed")
+
+	req, _ := http.NewRequest("GET", srv.URL+"?clientID=sse-client", nil)
+	req.Header.Set("Last-Event-ID", firstID)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to reconnect: %v", err)
+	}
+	defer res.Body.Close()
+
+	if _, data := readEvent(bufio.NewReader(res.Body)); data != "missed" {
+		t.Fatalf("expected replayed %q, got %q", "missed", data)
+	}
+}
+
+// Test that a WebSocket client only receives updates while subscribed.
+func TestWebSocketHandlerSubscribeUnsubscribe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(webSocketHandler))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"?clientID=ws-client")
 	if err != nil {
-		t.Fatalf("failed to read response body: %v", err)
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	send := func(msg wsMessage) {
+		t.Helper()
+		data, _ := json.Marshal(msg)
+		if err := conn.WriteMessage(websocket.OpText, data); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	read := func() wsMessage {
+		t.Helper()
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("invalid message %q: %v", data, err)
+		}
+		return msg
+	}
+
+	send(wsMessage{Type: "subscribe"})
+	if msg := read(); msg.Type != "subscribed" {
+		t.Fatalf("expected subscribed, got %+v", msg)
+	}
+
+	clientManager.BroadcastUpdate("ws-update")
+	if msg := read(); msg.Type != "update" || msg.Data != "ws-update" {
+		t.Fatalf("expected update ws-update, got %+v", msg)
+	}
+
+	send(wsMessage{Type: "unsubscribe"})
+	if msg := read(); msg.Type != "unsubscribed" {
+		t.Fatalf("expected unsubscribed, got %+v", msg)
 	}
 
-	got := strings.TrimSpace(string(body))
-	if got != "Update: test-update" {
-		t.Fatalf("expected %q, got %q", "Update: test-update", got)
+	// Anything broadcast now must not reach the client; the next message it
+	// sees is the error reply to an unknown request.
+	clientManager.BroadcastUpdate("not-delivered")
+	send(wsMessage{Type: "bogus"})
+	if msg := read(); msg.Type != "error" {
+		t.Fatalf("expected error after unsubscribe, got %+v", msg)
 	}
 }
 
+// Test that with authentication enabled the client ID and allowed topics come
+// from the token, and that other subscriptions are refused.
+func TestLongPollingHandlerAuthentication(t *testing.T) {
+	authenticator = auth.StaticTokens{"s3cret": {ClientID: "orders-dashboard", Topics: []string{"orders.#"}}}
+	t.Cleanup(func() { authenticator = nil })
+	h := withAuth(longPollingHandler)
+
+	poll := func(query, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/updates?timeout=0"+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	for name, c := range map[string]struct {
+		query, token string
+		want         int
+	}{
+		"no token":          {"&clientID=orders-dashboard", "", http.StatusUnauthorized},
+		"bad token":         {"", "wrong", http.StatusUnauthorized},
+		"other client":      {"&clientID=someone-else", "s3cret", http.StatusForbidden},
+		"forbidden topic":   {"&topic=payments.*", "s3cret", http.StatusForbidden},
+		"allowed topic":     {"&topic=orders.paid", "s3cret", http.StatusNoContent},
+		"narrowed to token": {"", "s3cret", http.StatusNoContent},
+	} {
+		if w := poll(c.query, c.token); w.Code != c.want {
+			t.Errorf("%s: expected %d, got %d (%s)", name, c.want, w.Code, w.Body.String())
+		}
+	}
+
+	// A poll without topics only receives what the token allows.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		clientManager.Publish("payments.created", "hidden")
+		clientManager.Publish("orders.created", "visible")
+	}()
+	req := httptest.NewRequest("GET", "/updates?timeout=2s", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	var resp pollResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if len(resp.Updates) != 1 || resp.Updates[0].Data != "visible" {
+		t.Fatalf("expected only the orders update, got %+v", resp.Updates)
+	}
+}
+
+// Test that /presence lists a client between polls along with live streams.
+func TestPresenceHandler(t *testing.T) {
+	prev := clientManager
+	clientManager = long_polling.NewClientManager(long_polling.WithPresence(time.Minute))
+	t.Cleanup(func() { clientManager = prev })
+
+	longPollingHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/updates?clientID=poller&timeout=0", nil))
+	stream, _ := clientManager.Subscribe("streamer", 0, "orders.*")
+	defer clientManager.Unsubscribe(stream)
+
+	w := httptest.NewRecorder()
+	presenceHandler(w, httptest.NewRequest("GET", "/presence", nil))
+	var body struct {
+		Clients []long_polling.ClientPresence `json:"clients"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if len(body.Clients) != 2 {
+		t.Fatalf("expected 2 clients, got %+v", body.Clients)
+	}
+	poller, streamer := body.Clients[0], body.Clients[1]
+	if poller.ClientID != "poller" || poller.Connected || len(poller.Subscriptions) != 0 {
+		t.Fatalf("unexpected poller entry %+v", poller)
+	}
+	if streamer.ClientID != "streamer" || !streamer.Connected || streamer.Subscriptions[0].Topics[0] != "orders.*" {
+		t.Fatalf("unexpected streamer entry %+v", streamer)
+	}
+}
+
+// Test that with authentication enabled only clients granted the presence
+// scope may list online clients or subscribe to presence events.
+func TestPresenceRequiresScope(t *testing.T) {
+	prev := clientManager
+	clientManager = long_polling.NewClientManager(long_polling.WithPresence(time.Minute))
+	authenticator = auth.StaticTokens{
+		"plain":   {ClientID: "dashboard", Topics: []string{"#"}},
+		"watcher": {ClientID: "ops", Topics: []string{"#"}, Scopes: []string{presenceScope}},
+		"none":    {ClientID: "guest"},
+	}
+	t.Cleanup(func() {
+		clientManager = prev
+		authenticator = nil
+	})
+
+	for name, c := range map[string]struct {
+		handler     http.HandlerFunc
+		path, token string
+		want        int
+	}{
+		"list without scope":      {presenceHandler, "/presence", "plain", http.StatusForbidden},
+		"list with scope":         {presenceHandler, "/presence", "watcher", http.StatusOK},
+		"subscribe without scope": {longPollingHandler, "/updates?timeout=0&topic=presence", "plain", http.StatusForbidden},
+		"subscribe with scope":    {longPollingHandler, "/updates?timeout=0&topic=presence", "watcher", http.StatusNoContent},
+		"other topics":            {longPollingHandler, "/updates?timeout=0&topic=orders.*", "plain", http.StatusNoContent},
+		"no topics granted":       {longPollingHandler, "/updates?timeout=0&topic=orders.*", "none", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		w := httptest.NewRecorder()
+		withAuth(c.handler).ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s: expected %d, got %d (%s)", name, c.want, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/redis/go-redis/v9"
+
+	long_polling "github.com/poeticcode01/poc/communication_protocol/long_polling"
+)
+
+// sourceConfig selects and configures where updates are read from.
+type sourceConfig struct {
+	kind          string // listen, poll, redis or kafka
+	postgresDSN   string
+	redisAddr     string
+	redisChannels []string
+	kafkaBrokers  []string
+	kafkaTopics   []string
+	kafkaGroup    string
+}
+
+// openUpdateSource builds the UpdateSource selected by cfg.kind. The returned
+// cleanup func releases its connections.
+func openUpdateSource(cfg sourceConfig) (long_polling.UpdateSource, func(), error) {
+	switch cfg.kind {
+	case "listen", "poll":
+		db, err := sql.Open("postgres", cfg.postgresDSN)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open database connection: %w", err)
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		log.Println("Successfully connected to database!")
+
+		if cfg.kind == "poll" {
+			source := long_polling.NewPostgresSource(db, 5*time.Second) // Check every 5 seconds
+			return source, func() { db.Close() }, nil
+		}
+		if err := long_polling.InstallNotifyTrigger(db); err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+		source := long_polling.NewListenSource(db, cfg.postgresDSN, 5*time.Second) // Polls only while disconnected
+		return source, func() { source.Close(); db.Close() }, nil
+
+	case "redis":
+		rdb := redis.NewClient(&redis.Options{Addr: cfg.redisAddr})
+		source := long_polling.NewRedisSource(rdb, cfg.redisChannels...)
+		return source, func() { source.Close(); rdb.Close() }, nil
+
+	case "kafka":
+		source, err := long_polling.NewKafkaSource(cfg.kafkaBrokers, cfg.kafkaGroup, cfg.kafkaTopics...)
+		if err != nil {
+			return nil, nil, err
+		}
+		source.TopicFunc = orderEventTopic
+		return source, func() { source.Close() }, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unknown source %q (want listen, poll, redis or kafka)", cfg.kind)
+	}
+}
+
+// orderEventTopic maps events from the kafka module's orders topic to
+// ClientManager topics, e.g. ORDER_PAID becomes "orders.paid", so clients can
+// subscribe to "orders.*" or a single event type. Other messages keep the
+// Kafka topic name.
+func orderEventTopic(msg *sarama.ConsumerMessage) string {
+	var event struct {
+		EventType string `json:"event_type"`
+	}
+	if err := json.Unmarshal(msg.Value, &event); err != nil || event.EventType == "" {
+		return msg.Topic
+	}
+	name := strings.ToLower(strings.TrimPrefix(event.EventType, "ORDER_"))
+	return msg.Topic + "." + name
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
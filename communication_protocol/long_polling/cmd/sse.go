@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	long_polling "github.com/poeticcode01/poc/communication_protocol/long_polling"
+)
+
+// sseHeartbeatInterval keeps idle streams alive through proxies and load balancers.
+var sseHeartbeatInterval = 15 * time.Second
+
+// sseHandler streams updates as Server-Sent Events. Browsers reconnect
+// automatically and send Last-Event-ID, which is used to replay missed updates.
+func sseHandler(w http.ResponseWriter, r *http.Request) {
+	clientID, allowed, status, err := clientIdentity(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventID") // For clients that can't set headers
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	topics, err := parseTopics(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if topics, err = long_polling.AuthorizeTopics(allowed, topics); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := authorizePresenceTopics(r, topics); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("SSE client %s: streaming unsupported: %v", clientID, err)
+		return
+	}
+
+	sub, backlog := clientManager.Subscribe(clientID, lastID, topics...)
+	defer clientManager.Unsubscribe(sub)
+
+	for _, u := range backlog.Updates {
+		if err := writeSSEEvent(w, u); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case u, ok := <-sub.Updates():
+			if !ok {
+				// Dropped as a slow consumer; the client will reconnect and resume.
+				log.Printf("SSE client %s dropped", clientID)
+				return
+			}
+			if err := writeSSEEvent(w, u); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			log.Printf("SSE client %s disconnected", clientID)
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeSSEEvent writes a single update in text/event-stream format.
+// Multi-line data is split across several data: fields as the spec requires.
+func writeSSEEvent(w http.ResponseWriter, u long_polling.Update) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "id: %d\nevent: update\n", u.ID)
+	for _, line := range strings.Split(u.Data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := fmt.Fprint(w, b.String())
+	return err
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	long_polling "github.com/poeticcode01/poc/communication_protocol/long_polling"
+	"github.com/poeticcode01/poc/communication_protocol/long_polling/websocket"
+)
+
+var (
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = 60 * time.Second // Must be greater than wsPingInterval
+)
+
+// wsMessage is the JSON envelope exchanged over the WebSocket in both directions.
+// Clients send "subscribe" and "unsubscribe", optionally with topic patterns
+// (and lastID to resume); the server sends "subscribed", "unsubscribed",
+// "update" and "error".
+type wsMessage struct {
+	Type   string   `json:"type"`
+	ID     uint64   `json:"id,omitempty"`
+	Topic  string   `json:"topic,omitempty"`
+	Topics []string `json:"topics,omitempty"`
+	Data   string   `json:"data,omitempty"`
+	LastID uint64   `json:"lastID,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// webSocketHandler upgrades the connection and forwards ClientManager updates
+// while the client is subscribed.
+func webSocketHandler(w http.ResponseWriter, r *http.Request) {
+	clientID, allowed, status, err := clientIdentity(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		log.Printf("WebSocket upgrade for %s failed: %v", clientID, err)
+		return
+	}
+
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.PongHandler = func(string) {
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	}
+
+	// The reader goroutine owns ReadMessage; everything else happens below.
+	incoming := make(chan wsMessage)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			var msg wsMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				msg = wsMessage{Type: "invalid"}
+			}
+			select {
+			case incoming <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+	// Completes the close handshake; a no-op if the peer already closed.
+	defer conn.Close(websocket.CloseGoingAway, "")
+
+	var (
+		sub    *long_polling.Subscription // nil while unsubscribed
+		topics []string                   // Current patterns; empty means every topic
+		lastID uint64
+	)
+	unsubscribe := func() {
+		if sub != nil {
+			clientManager.Unsubscribe(sub)
+			sub = nil
+		}
+		topics = nil
+	}
+	defer unsubscribe()
+
+	send := func(msg wsMessage) bool {
+		data, _ := json.Marshal(msg)
+		if err := conn.WriteMessage(websocket.OpText, data); err != nil {
+			log.Printf("WebSocket client %s write failed: %v", clientID, err)
+			return false
+		}
+		return true
+	}
+	subscribe := func(from uint64) bool {
+		if sub != nil {
+			clientManager.Unsubscribe(sub)
+		}
+		var backlog long_polling.Backlog
+		sub, backlog = clientManager.Subscribe(clientID, from, topics...)
+		for _, u := range backlog.Updates {
+			if !send(wsMessage{Type: "update", ID: u.ID, Topic: u.Topic, Data: u.Data}) {
+				return false
+			}
+		}
+		// Everything up to the cursor was considered, so a resubscription
+		// after a slow-consumer drop picks up from here even if nothing has
+		// been delivered yet.
+		lastID = backlog.Cursor
+		return true
+	}
+
+	// handle applies a client request and returns the reply to send.
+	// Subscribing adds topics (or switches to every topic if none are given);
+	// unsubscribing removes topics, and the subscription ends once none are left.
+	handle := func(msg wsMessage) (wsMessage, bool) {
+		for _, t := range msg.Topics {
+			if err := long_polling.ValidateTopicPattern(t); err != nil {
+				return wsMessage{Type: "error", Error: err.Error()}, true
+			}
+		}
+		switch msg.Type {
+		case "subscribe":
+			// "Every topic" is narrowed to what the client is allowed.
+			requested, err := long_polling.AuthorizeTopics(allowed, msg.Topics)
+			if err != nil {
+				return wsMessage{Type: "error", Error: err.Error()}, true
+			}
+			if err := authorizePresenceTopics(r, requested); err != nil {
+				return wsMessage{Type: "error", Error: err.Error()}, true
+			}
+			switch {
+			case sub == nil:
+				topics = append([]string(nil), requested...)
+				if !subscribe(msg.LastID) {
+					return wsMessage{}, false
+				}
+			case len(msg.Topics) == 0:
+				topics = append([]string(nil), requested...)
+				clientManager.SetTopics(sub, topics...)
+			case len(topics) > 0:
+				topics = addTopics(topics, requested)
+				clientManager.SetTopics(sub, topics...)
+			}
+			return wsMessage{Type: "subscribed", Topics: topics}, true
+		case "unsubscribe":
+			if sub != nil && len(msg.Topics) > 0 {
+				if len(topics) == 0 {
+					return wsMessage{Type: "error", Error: "subscribed to every topic; unsubscribe without topics"}, true
+				}
+				topics = removeTopics(topics, msg.Topics)
+				if len(topics) > 0 {
+					clientManager.SetTopics(sub, topics...)
+					return wsMessage{Type: "unsubscribed", Topics: msg.Topics}, true
+				}
+			}
+			unsubscribe()
+			return wsMessage{Type: "unsubscribed", Topics: msg.Topics}, true
+		default:
+			return wsMessage{Type: "error", Error: "unknown message type"}, true
+		}
+	}
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		var updates <-chan long_polling.Update // nil (never ready) while unsubscribed
+		if sub != nil {
+			updates = sub.Updates()
+		}
+		select {
+		case msg := <-incoming:
+			reply, ok := handle(msg)
+			if !ok || !send(reply) {
+				return
+			}
+		case u, ok := <-updates:
+			if !ok {
+				// Dropped as a slow consumer; resubscribe and replay from history.
+				sub = nil
+				if !subscribe(lastID) {
+					return
+				}
+				continue
+			}
+			if !send(wsMessage{Type: "update", ID: u.ID, Topic: u.Topic, Data: u.Data}) {
+				return
+			}
+			lastID = u.ID
+		case <-ping.C:
+			if err := conn.WritePing(nil); err != nil {
+				return
+			}
+		case err := <-readErr:
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) {
+				log.Printf("WebSocket client %s closed: %d %s", clientID, ce.Code, ce.Reason)
+			} else {
+				log.Printf("WebSocket client %s disconnected: %v", clientID, err)
+			}
+			return
+		}
+	}
+}
+
+// addTopics returns topics with extra appended, skipping duplicates.
+func addTopics(topics, extra []string) []string {
+	for _, t := range extra {
+		if !slices.Contains(topics, t) {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+// removeTopics returns topics without any of remove.
+func removeTopics(topics, remove []string) []string {
+	return slices.DeleteFunc(topics, func(t string) bool {
+		return slices.Contains(remove, t)
+	})
+}
@@ -0,0 +1,195 @@
+package long_polling
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// KafkaSource reads updates from Kafka topics through a consumer group.
+// A message's offset is only marked for commit once the batch holding it has
+// been published (see Acker), so messages that were consumed but not yet
+// published when the server stopped are delivered again: at-least-once.
+//
+// The group is joined on the first Next and left by Stop (see Stopper), so a
+// ClusterNotifier replica only holds partitions while it is the leader.
+type KafkaSource struct {
+	newGroup func() (sarama.ConsumerGroup, error)
+	topics   []string
+
+	// TopicFunc maps a Kafka message to the ClientManager topic it is
+	// published on. By default the Kafka topic name is used.
+	TopicFunc func(msg *sarama.ConsumerMessage) string
+
+	mu       sync.Mutex           // Guards group, cancel and done
+	group    sarama.ConsumerGroup // nil once left, until Next joins again
+	cancel   context.CancelFunc   // Stops the consume loop; nil if not running
+	done     chan struct{}        // Closed when the consume loop has exited
+	messages chan kafkaMessage
+	unacked  []kafkaMessage // Returned by Next, not yet acknowledged
+}
+
+// kafkaMessage is a consumed message waiting to be published, with what is
+// needed to mark its offset afterwards.
+type kafkaMessage struct {
+	msg     Message
+	raw     *sarama.ConsumerMessage
+	session sarama.ConsumerGroupSession
+}
+
+// NewKafkaSource creates a source for consumer group groupID on the given
+// brokers. Each server that should see every message needs its own groupID,
+// since members of one group split the partitions between them.
+func NewKafkaSource(brokers []string, groupID string, topics ...string) (*KafkaSource, error) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_1_0_0
+	config.Consumer.Offsets.Initial = sarama.OffsetNewest // Like the Postgres sources, start from now
+
+	newGroup := func() (sarama.ConsumerGroup, error) {
+		return sarama.NewConsumerGroup(brokers, groupID, config)
+	}
+	// Create the first group up front so a bad configuration fails here.
+	group, err := newGroup()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	s := newKafkaSource(newGroup, topics)
+	s.group = group
+	return s, nil
+}
+
+func newKafkaSource(newGroup func() (sarama.ConsumerGroup, error), topics []string) *KafkaSource {
+	return &KafkaSource{
+		newGroup: newGroup,
+		topics:   topics,
+		messages: make(chan kafkaMessage, 256),
+	}
+}
+
+// Next waits for a message and returns it together with any others already
+// consumed. Call Ack once they are published.
+func (s *KafkaSource) Next(ctx context.Context) ([]Message, error) {
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+
+	var batch []Message
+	select {
+	case m := <-s.messages:
+		batch = append(batch, m.msg)
+		s.unacked = append(s.unacked, m)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	for {
+		select {
+		case m := <-s.messages:
+			batch = append(batch, m.msg)
+			s.unacked = append(s.unacked, m)
+		default:
+			return batch, nil
+		}
+	}
+}
+
+// Ack marks the offsets of every message returned by Next so far. Marks made
+// on a session that ended in a rebalance are dropped, and the new owner of
+// the partition consumes those messages again.
+func (s *KafkaSource) Ack() {
+	for _, m := range s.unacked {
+		m.session.MarkMessage(m.raw, "")
+	}
+	clear(s.unacked)
+	s.unacked = s.unacked[:0]
+}
+
+// start joins the group, if needed, and runs the consume loop unless it is
+// already running. Consume returns on every rebalance and must be called again.
+func (s *KafkaSource) start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return nil
+	}
+	if s.group == nil {
+		group, err := s.newGroup()
+		if err != nil {
+			return fmt.Errorf("failed to create consumer group: %w", err)
+		}
+		s.group = group
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	group, done := s.group, make(chan struct{})
+	s.cancel, s.done = cancel, done
+	go func() {
+		defer close(done)
+		for {
+			if err := group.Consume(ctx, s.topics, kafkaHandler{s}); err != nil {
+				log.Printf("Kafka consume error: %v", err)
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop leaves the consumer group, so its partitions go to the other members
+// straight away rather than after the session times out. Messages consumed
+// but not acknowledged are dropped; whoever gets their partitions consumes
+// them again. The next call to Next joins the group again.
+func (s *KafkaSource) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+		s.cancel, s.done = nil, nil
+	}
+	for len(s.messages) > 0 {
+		<-s.messages
+	}
+	clear(s.unacked)
+	s.unacked = s.unacked[:0]
+	if s.group == nil {
+		return nil
+	}
+	err := s.group.Close()
+	s.group = nil
+	return err
+}
+
+// Close leaves the consumer group.
+func (s *KafkaSource) Close() error {
+	return s.Stop()
+}
+
+type kafkaHandler struct {
+	source *KafkaSource
+}
+
+func (kafkaHandler) Setup(_ sarama.ConsumerGroupSession) error   { return nil }
+func (kafkaHandler) Cleanup(_ sarama.ConsumerGroupSession) error { return nil }
+
+func (h kafkaHandler) ConsumeClaim(
+	session sarama.ConsumerGroupSession,
+	claim sarama.ConsumerGroupClaim,
+) error {
+	for msg := range claim.Messages() {
+		topic := msg.Topic
+		if h.source.TopicFunc != nil {
+			topic = h.source.TopicFunc(msg)
+		}
+		m := kafkaMessage{msg: Message{Topic: topic, Data: string(msg.Value)}, raw: msg, session: session}
+		select {
+		case h.source.messages <- m:
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package long_polling
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// fakeSession records marked offsets.
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *fakeSession) markedOffsets() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.marked...)
+}
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// fakeGroup runs one session with a single claim fed by the test. Like
+// sarama, it closes the claim's channel when the session ends.
+type fakeGroup struct {
+	sarama.ConsumerGroup
+	session *fakeSession
+	claim   *fakeClaim
+	left    atomic.Bool
+}
+
+func newFakeGroup(buffer int) *fakeGroup {
+	return &fakeGroup{
+		session: &fakeSession{},
+		claim:   &fakeClaim{messages: make(chan *sarama.ConsumerMessage, buffer)},
+	}
+}
+
+// groupFactory returns a group factory for newKafkaSource that hands out a
+// new fakeGroup each time, and a channel receiving each one handed out.
+func groupFactory(buffer int) (func() (sarama.ConsumerGroup, error), chan *fakeGroup) {
+	groups := make(chan *fakeGroup, 8)
+	return func() (sarama.ConsumerGroup, error) {
+		g := newFakeGroup(buffer)
+		groups <- g
+		return g, nil
+	}, groups
+}
+
+func (g *fakeGroup) Consume(ctx context.Context, _ []string, h sarama.ConsumerGroupHandler) error {
+	g.session.ctx = ctx
+	go func() {
+		<-ctx.Done()
+		close(g.claim.messages)
+	}()
+	err := h.ConsumeClaim(g.session, g.claim)
+	<-ctx.Done()
+	return err
+}
+
+func (g *fakeGroup) Close() error {
+	g.left.Store(true)
+	return nil
+}
+
+// Test that offsets are only marked once the batch has been acknowledged,
+// i.e. after it was published.
+func TestKafkaSourceMarksAfterAck(t *testing.T) {
+	group := newFakeGroup(2)
+	src := newKafkaSource(func() (sarama.ConsumerGroup, error) { return group, nil }, []string{"orders"})
+	defer src.Close()
+
+	group.claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 7, Value: []byte("a")}
+	group.claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 8, Value: []byte("b")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var got []Message
+	for len(got) < 2 {
+		batch, err := src.Next(ctx)
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		got = append(got, batch...)
+	}
+	if got[0].Topic != "orders" || got[0].Data != "a" || got[1].Data != "b" {
+		t.Fatalf("unexpected messages %+v", got)
+	}
+	if marked := group.session.markedOffsets(); len(marked) != 0 {
+		t.Fatalf("offsets marked before Ack: %v", marked)
+	}
+
+	src.Ack()
+	if marked := group.session.markedOffsets(); len(marked) != 2 || marked[0] != 7 || marked[1] != 8 {
+		t.Fatalf("expected offsets [7 8] marked after Ack, got %v", marked)
+	}
+	src.Ack()
+	if marked := group.session.markedOffsets(); len(marked) != 2 {
+		t.Fatalf("second Ack marked again: %v", marked)
+	}
+}
+
+// Test that UpdateNotifier acknowledges a batch once it has published it.
+func TestUpdateNotifierAcksAfterPublish(t *testing.T) {
+	group := newFakeGroup(1)
+	src := newKafkaSource(func() (sarama.ConsumerGroup, error) { return group, nil }, nil)
+	defer src.Close()
+
+	cm := NewClientManager()
+	sub, _ := cm.Subscribe("c1", 0)
+	defer cm.Unsubscribe(sub)
+	notifier := NewUpdateNotifier(cm, src)
+	go notifier.Start()
+	defer notifier.Stop()
+
+	group.claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 3, Value: []byte("x")}
+	select {
+	case u := <-sub.Updates():
+		if u.Data != "x" {
+			t.Fatalf("expected x, got %q", u.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message was not published")
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(group.session.markedOffsets()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("offset was not marked after publishing")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Test that Stop leaves the group and drops what was consumed but not
+// acknowledged, and that the next Next joins a new group.
+func TestKafkaSourceStopLeavesGroup(t *testing.T) {
+	factory, groups := groupFactory(2)
+	src := newKafkaSource(factory, nil)
+	defer src.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got := make(chan []Message, 1)
+	go func() {
+		batch, _ := src.Next(ctx) // Joins the first group
+		got <- batch
+	}()
+	first := <-groups
+	first.claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 1, Value: []byte("a")}
+	first.claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 2, Value: []byte("b")}
+	if batch := <-got; len(batch) == 0 {
+		t.Fatal("expected a batch from the first group")
+	}
+
+	if err := src.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if !first.left.Load() {
+		t.Fatal("expected Stop to leave the group")
+	}
+	src.Ack()
+	if marked := first.session.markedOffsets(); len(marked) != 0 {
+		t.Fatalf("expected nothing to be marked after Stop, got %v", marked)
+	}
+
+	go func() {
+		batch, _ := src.Next(ctx)
+		got <- batch
+	}()
+	second := <-groups
+	second.claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 1, Value: []byte("a")}
+	if batch := <-got; len(batch) != 1 || batch[0].Data != "a" {
+		t.Fatalf("expected a from the new group, got %+v", batch)
+	}
+}
+
+// Test that a ClusterNotifier leader that loses its lock leaves the Kafka
+// group, so its partitions go to the next leader.
+func TestClusterStepdownLeavesKafkaGroup(t *testing.T) {
+	factory, groups := groupFactory(1)
+	src := newKafkaSource(factory, nil)
+	defer src.Close()
+
+	holder := &atomic.Pointer[memoryLock]{}
+	cn := NewClusterNotifier(NewClientManager(), src, (&memoryHub{}).join(), &memoryLock{holder: holder}, &memoryState{}, 10*time.Millisecond)
+	go cn.Start()
+	defer cn.Stop()
+
+	var group *fakeGroup
+	select {
+	case group = <-groups:
+	case <-time.After(time.Second):
+		t.Fatal("the leader did not join the group")
+	}
+	holder.Store(&memoryLock{holder: holder}) // Another replica takes over
+	deadline := time.Now().Add(time.Second)
+	for !group.left.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("the old leader did not leave the group")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
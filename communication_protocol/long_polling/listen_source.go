@@ -0,0 +1,189 @@
+package long_polling
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// updatesChannel is the Postgres NOTIFY channel the updates trigger publishes on.
+const updatesChannel = "updates"
+
+// notifyMigration creates the updates table if needed, adds the topic column
+// to tables created before topics existed, and installs a trigger
+// that NOTIFYs the new row's id on every insert. Only the id is sent because
+// NOTIFY payloads are limited to 8000 bytes; the row is read back by id.
+const notifyMigration = `
+CREATE TABLE IF NOT EXISTS updates (
+	id SERIAL PRIMARY KEY,
+	topic TEXT NOT NULL DEFAULT '',
+	message TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+` + topicMigration + `;
+
+CREATE OR REPLACE FUNCTION notify_update() RETURNS trigger AS $$
+BEGIN
+	PERFORM pg_notify('` + updatesChannel + `', NEW.id::text);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS updates_notify ON updates;
+CREATE TRIGGER updates_notify
+	AFTER INSERT ON updates
+	FOR EACH ROW EXECUTE FUNCTION notify_update();
+`
+
+// InstallNotifyTrigger runs the migration needed by ListenSource. It is
+// idempotent and safe to run on every start.
+func InstallNotifyTrigger(db *sql.DB) error {
+	if _, err := db.Exec(notifyMigration); err != nil {
+		return fmt.Errorf("failed to install notify trigger: %w", err)
+	}
+	return nil
+}
+
+// ListenSource waits for Postgres to NOTIFY about new rows in the updates
+// table. Notifications only wake it up: rows are always read by id the way
+// updatesReader describes, so bursts are never collapsed, and anything inserted while
+// the listener connection was down is picked up by polling until it reconnects.
+type ListenSource struct {
+	reader       updatesReader
+	connStr      string        // Connection string for the dedicated LISTEN connection
+	pollInterval time.Duration // Polling interval while the listener is disconnected
+	listener     notifier
+	connected    bool
+	events       chan pq.ListenerEventType
+}
+
+// notifier is the part of *pq.Listener that ListenSource waits on.
+type notifier interface {
+	NotificationChannel() <-chan *pq.Notification
+	Ping() error
+	Close() error
+}
+
+// NewListenSource creates a ListenSource. db is used for reading rows;
+// connStr opens the separate connection that LISTENs. Run InstallNotifyTrigger
+// first.
+func NewListenSource(db *sql.DB, connStr string, pollInterval time.Duration) *ListenSource {
+	return &ListenSource{
+		reader:       updatesReader{db: db},
+		connStr:      connStr,
+		pollInterval: pollInterval,
+		events:       make(chan pq.ListenerEventType, 8),
+	}
+}
+
+// Checkpoint returns how far the table has been read; see Checkpointer.
+func (s *ListenSource) Checkpoint() string {
+	return s.reader.checkpoint()
+}
+
+// Resume continues reading from a position returned by Checkpoint.
+func (s *ListenSource) Resume(pos string) error {
+	return s.reader.resume(pos)
+}
+
+// Next waits for a notification (or, while disconnected, the poll interval)
+// and returns every row inserted since the previous call.
+func (s *ListenSource) Next(ctx context.Context) ([]Message, error) {
+	if s.listener == nil {
+		if err := s.reader.start(ctx); err != nil {
+			return nil, err
+		}
+		l := pq.NewListener(s.connStr, time.Second, 30*time.Second, s.onEvent)
+		if err := l.Listen(updatesChannel); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to listen on %q: %w", updatesChannel, err)
+		}
+		s.listener = l
+		s.connected = true
+	}
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		msgs, err := s.reader.readNew(ctx)
+		if err != nil || len(msgs) > 0 {
+			return msgs, err
+		}
+		if err := s.wait(ctx, ticker.C); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// wait blocks until there may be new rows to read: a notification arrived,
+// the listener reconnected, or tick fired while it was disconnected. While
+// connected, tick pings the listener instead.
+func (s *ListenSource) wait(ctx context.Context, tick <-chan time.Time) error {
+	for {
+		select {
+		case <-s.listener.NotificationChannel():
+			// The payload is only a row id and rows are read by id anyway. A nil
+			// notification means the connection was re-established and
+			// notifications may have been missed; reading covers both cases.
+			s.drainNotifications()
+			return nil
+		case ev := <-s.events:
+			switch ev {
+			case pq.ListenerEventDisconnected:
+				log.Println("Update listener disconnected, falling back to polling")
+				s.connected = false
+			case pq.ListenerEventReconnected:
+				log.Println("Update listener reconnected")
+				s.connected = true
+				return nil
+			}
+		case <-tick:
+			if !s.connected {
+				return nil
+			}
+			// Detects dead connections that haven't errored yet. A ping on a
+			// dead connection can hang until TCP gives up, so it must not
+			// block the wait.
+			go s.listener.Ping()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close closes the LISTEN connection.
+func (s *ListenSource) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// onEvent is called from the listener's goroutine and must not block.
+func (s *ListenSource) onEvent(ev pq.ListenerEventType, err error) {
+	if err != nil {
+		log.Printf("Update listener event %d: %v", ev, err)
+	}
+	select {
+	case s.events <- ev:
+	default:
+	}
+}
+
+// drainNotifications discards notifications that are already queued so a
+// burst of inserts results in a single read.
+func (s *ListenSource) drainNotifications() {
+	for {
+		select {
+		case <-s.listener.NotificationChannel():
+		default:
+			return
+		}
+	}
+}
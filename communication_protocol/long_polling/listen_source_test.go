@@ -0,0 +1,155 @@
+package long_polling
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// fakeNotifier stands in for *pq.Listener. Ping blocks until unblock is
+// closed, as it does on a connection that died without erroring.
+type fakeNotifier struct {
+	notify  chan *pq.Notification
+	pinged  chan struct{}
+	unblock chan struct{}
+}
+
+func newFakeNotifier(t *testing.T) *fakeNotifier {
+	n := &fakeNotifier{notify: make(chan *pq.Notification, 8), pinged: make(chan struct{}, 8), unblock: make(chan struct{})}
+	t.Cleanup(func() { close(n.unblock) })
+	return n
+}
+
+func (n *fakeNotifier) NotificationChannel() <-chan *pq.Notification { return n.notify }
+
+func (n *fakeNotifier) Ping() error {
+	n.pinged <- struct{}{}
+	<-n.unblock
+	return errors.New("connection reset")
+}
+
+func (n *fakeNotifier) Close() error { return nil }
+
+func newTestListenSource(t *testing.T) (*ListenSource, *fakeNotifier) {
+	n := newFakeNotifier(t)
+	s := NewListenSource(nil, "", time.Second)
+	s.listener = n
+	s.connected = true
+	return s, n
+}
+
+// waitAsync runs s.wait in a goroutine and returns its result channel.
+func waitAsync(s *ListenSource, tick <-chan time.Time) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- s.wait(context.Background(), tick) }()
+	return done
+}
+
+func expectWoken(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("wait failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return")
+	}
+}
+
+func expectWaiting(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		t.Fatalf("wait returned early: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// Test that any notification wakes the source whatever its payload, including
+// the nil one sent after a reconnect, and that a burst is collapsed into a
+// single wake-up.
+func TestListenSourceWakesOnNotification(t *testing.T) {
+	s, n := newTestListenSource(t)
+	for _, payload := range []*pq.Notification{
+		{Channel: updatesChannel, Extra: "42"},
+		{Channel: updatesChannel, Extra: "not-an-id"},
+		nil,
+	} {
+		n.notify <- payload
+		expectWoken(t, waitAsync(s, nil))
+	}
+
+	for i := 0; i < 5; i++ {
+		n.notify <- &pq.Notification{Channel: updatesChannel, Extra: "1"}
+	}
+	expectWoken(t, waitAsync(s, nil))
+	if len(n.notify) != 0 {
+		t.Fatalf("expected the burst to be drained, %d left", len(n.notify))
+	}
+}
+
+// Test that a disconnect falls back to polling on every tick, and that the
+// reconnect wakes the source to read whatever was missed.
+func TestListenSourceReconnect(t *testing.T) {
+	s, _ := newTestListenSource(t)
+	tick := make(chan time.Time)
+
+	s.onEvent(pq.ListenerEventDisconnected, errors.New("connection refused"))
+	done := waitAsync(s, tick)
+	// The tick is only taken once the event has been handled.
+	for len(s.events) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	tick <- time.Now()
+	expectWoken(t, done)
+	if s.connected {
+		t.Fatal("expected the source to be marked disconnected")
+	}
+
+	done = waitAsync(s, tick)
+	tick <- time.Now()
+	expectWoken(t, done)
+
+	done = waitAsync(s, tick)
+	expectWaiting(t, done)
+	s.onEvent(pq.ListenerEventReconnected, nil)
+	expectWoken(t, done)
+	if !s.connected {
+		t.Fatal("expected the source to be marked connected")
+	}
+}
+
+// Test that a tick while connected pings the listener instead of polling, and
+// that a ping hanging on a dead connection does not hold up the wait.
+func TestListenSourcePing(t *testing.T) {
+	s, n := newTestListenSource(t)
+	tick := make(chan time.Time)
+
+	done := waitAsync(s, tick)
+	tick <- time.Now()
+	tick <- time.Now()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-n.pinged:
+		case <-time.After(time.Second):
+			t.Fatalf("expected 2 pings, got %d", i)
+		}
+	}
+	expectWaiting(t, done)
+
+	n.notify <- &pq.Notification{Channel: updatesChannel, Extra: "7"}
+	expectWoken(t, done)
+}
+
+func TestListenSourceWaitCanceled(t *testing.T) {
+	s, _ := newTestListenSource(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.wait(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
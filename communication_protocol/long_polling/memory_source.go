@@ -0,0 +1,49 @@
+package long_polling
+
+import (
+	"context"
+	"sync"
+)
+
+// MemorySource is an UpdateSource fed directly by Push. It is handy for tests
+// and demos that should not need a database or broker.
+type MemorySource struct {
+	mu      sync.Mutex
+	pending []Message
+	ready   chan struct{} // Signalled when pending becomes non-empty
+}
+
+func NewMemorySource() *MemorySource {
+	return &MemorySource{ready: make(chan struct{}, 1)}
+}
+
+// Push queues messages for the next call to Next.
+func (s *MemorySource) Push(msgs ...Message) {
+	s.mu.Lock()
+	s.pending = append(s.pending, msgs...)
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Next returns everything pushed since the previous call, waiting if nothing is queued.
+func (s *MemorySource) Next(ctx context.Context) ([]Message, error) {
+	for {
+		s.mu.Lock()
+		if len(s.pending) > 0 {
+			batch := s.pending
+			s.pending = nil
+			s.mu.Unlock()
+			return batch, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
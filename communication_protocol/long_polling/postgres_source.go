@@ -0,0 +1,236 @@
+package long_polling
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq" // For PostgreSQL example
+)
+
+// topicMigration adds the topic column to updates tables created before
+// topics existed. It is idempotent and runs whenever a source starts.
+const topicMigration = `ALTER TABLE updates ADD COLUMN IF NOT EXISTS topic TEXT NOT NULL DEFAULT ''`
+
+// updatesReader reads rows from the updates table by id. It expects a
+// table like:
+//
+//	CREATE TABLE updates (
+//	  id SERIAL PRIMARY KEY,
+//	  topic TEXT NOT NULL DEFAULT '',
+//	  message TEXT NOT NULL,
+//	  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+//	);
+//
+// Ids are handed out when a row is inserted, not when its transaction
+// commits, so a row can become visible after rows with higher ids: id 11
+// commits, then id 10. A plain "id > last seen" mark would skip 10 for good.
+// Instead every read covers all ids above a floor and drops those already
+// delivered; an id missing below the highest delivered one is a gap that
+// keeps the floor from moving for up to gapTimeout, after which it is
+// assumed rolled back. A row whose transaction commits more than gapTimeout
+// after a later id has been read is therefore still lost, and ids are not
+// remembered across restarts.
+type updatesReader struct {
+	db         *sql.DB
+	gapTimeout time.Duration       // How long a missing id may hold the floor; defaultGapTimeout if 0
+	floor      int64               // Every id <= floor was delivered or given up on
+	delivered  map[int64]bool      // Delivered ids above floor
+	gaps       map[int64]time.Time // Missing ids above floor, and when they were first noticed
+	started    bool
+	resumed    bool // The floor came from resume rather than from the table
+}
+
+const defaultGapTimeout = time.Minute
+
+// start adds the topic column if it is missing and sets the floor to the
+// newest existing row, so only rows inserted from now on are delivered.
+func (r *updatesReader) start(ctx context.Context) error {
+	if r.started {
+		return nil
+	}
+	if _, err := r.db.ExecContext(ctx, topicMigration); err != nil {
+		return fmt.Errorf("failed to add the topic column to updates: %w", err)
+	}
+	if !r.resumed {
+		if err := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM updates`).Scan(&r.floor); err != nil {
+			return fmt.Errorf("failed to read updates high-water mark: %w", err)
+		}
+	}
+	r.started = true
+	return nil
+}
+
+// checkpoint encodes the floor followed by the delivered ids above it, e.g.
+// "41,43,44".
+func (r *updatesReader) checkpoint() string {
+	ids := make([]int64, 0, len(r.delivered))
+	for id := range r.delivered {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	var b strings.Builder
+	b.WriteString(strconv.FormatInt(r.floor, 10))
+	for _, id := range ids {
+		b.WriteByte(',')
+		b.WriteString(strconv.FormatInt(id, 10))
+	}
+	return b.String()
+}
+
+// resume restores a position returned by checkpoint. Gaps are not saved; the
+// ids still missing below the delivered ones are noticed again on the next
+// read.
+func (r *updatesReader) resume(pos string) error {
+	parts := strings.Split(pos, ",")
+	floor, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid updates position %q", pos)
+	}
+	delivered := make(map[int64]bool, len(parts)-1)
+	for _, p := range parts[1:] {
+		id, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || id <= floor {
+			return fmt.Errorf("invalid updates position %q", pos)
+		}
+		delivered[id] = true
+	}
+	r.floor = floor
+	r.delivered = delivered
+	r.gaps = make(map[int64]time.Time)
+	r.resumed = true
+	return nil
+}
+
+// readNew returns every row above the floor that was not delivered yet, in
+// id order, and moves the floor up past the ids that can no longer change.
+func (r *updatesReader) readNew(ctx context.Context) ([]Message, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, topic, message, created_at
+         FROM updates
+         WHERE id > $1
+         ORDER BY id ASC`,
+		r.floor,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query database: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		msgs []Message
+		ids  []int64
+	)
+	for rows.Next() {
+		var (
+			id        int64
+			topic     string
+			msg       string
+			createdAt time.Time
+		)
+		if err := rows.Scan(&id, &topic, &msg, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if r.delivered[id] {
+			continue
+		}
+		msgs = append(msgs, Message{
+			Topic: topic,
+			Data:  fmt.Sprintf("New data: %s (at %s)", msg, createdAt.Format(time.RFC3339)),
+		})
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	// Only record the batch once it was read in full, so a failed read is retried.
+	r.advance(ids, time.Now())
+	return msgs, nil
+}
+
+// advance records ids as delivered, notes the gaps below them and raises the
+// floor over every id that is delivered or has been missing for too long.
+func (r *updatesReader) advance(ids []int64, now time.Time) {
+	if r.delivered == nil {
+		r.delivered = make(map[int64]bool)
+		r.gaps = make(map[int64]time.Time)
+	}
+	top := r.floor
+	for id := range r.delivered {
+		top = max(top, id)
+	}
+	for _, id := range ids {
+		r.delivered[id] = true
+		delete(r.gaps, id)
+		top = max(top, id)
+	}
+	for id := r.floor + 1; id < top; id++ {
+		if _, ok := r.gaps[id]; !ok && !r.delivered[id] {
+			r.gaps[id] = now
+		}
+	}
+
+	timeout := r.gapTimeout
+	if timeout <= 0 {
+		timeout = defaultGapTimeout
+	}
+	for {
+		next := r.floor + 1
+		if r.delivered[next] {
+			delete(r.delivered, next)
+		} else if since, ok := r.gaps[next]; ok && now.Sub(since) >= timeout {
+			delete(r.gaps, next)
+		} else {
+			return
+		}
+		r.floor = next
+	}
+}
+
+// PostgresSource polls the updates table on an interval.
+type PostgresSource struct {
+	reader   updatesReader
+	interval time.Duration
+}
+
+// NewPostgresSource creates a polling source. Only rows inserted after the
+// first call to Next are delivered.
+func NewPostgresSource(db *sql.DB, interval time.Duration) *PostgresSource {
+	return &PostgresSource{
+		reader:   updatesReader{db: db},
+		interval: interval,
+	}
+}
+
+// Checkpoint returns how far the table has been read; see Checkpointer.
+func (s *PostgresSource) Checkpoint() string {
+	return s.reader.checkpoint()
+}
+
+// Resume continues reading from a position returned by Checkpoint.
+func (s *PostgresSource) Resume(pos string) error {
+	return s.reader.resume(pos)
+}
+
+// Next polls until new rows appear and returns all of them.
+func (s *PostgresSource) Next(ctx context.Context) ([]Message, error) {
+	if err := s.reader.start(ctx); err != nil {
+		return nil, err
+	}
+	for {
+		msgs, err := s.reader.readNew(ctx)
+		if err != nil || len(msgs) > 0 {
+			return msgs, err
+		}
+		select {
+		case <-time.After(s.interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
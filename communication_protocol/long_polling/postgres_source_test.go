@@ -0,0 +1,67 @@
+package long_polling
+
+import (
+	"testing"
+	"time"
+)
+
+// Test that an id committed after a higher one still holds the floor, so the
+// next read covers it, and that the floor only skips a gap once it times out.
+func TestUpdatesReaderGapTracking(t *testing.T) {
+	r := &updatesReader{floor: 9, gapTimeout: time.Minute}
+	now := time.Now()
+
+	// Id 11 commits before id 10.
+	r.advance([]int64{11}, now)
+	if r.floor != 9 {
+		t.Fatalf("floor moved past the in-flight id 10: %d", r.floor)
+	}
+	if !r.delivered[11] {
+		t.Fatal("expected 11 to be remembered as delivered")
+	}
+
+	// 10 commits; both are now below the floor and forgotten.
+	r.advance([]int64{10}, now.Add(time.Second))
+	if r.floor != 11 || len(r.delivered) != 0 || len(r.gaps) != 0 {
+		t.Fatalf("expected floor 11 with nothing pending, got floor %d delivered %v gaps %v", r.floor, r.delivered, r.gaps)
+	}
+
+	// 12 is rolled back and never appears: 13 is delivered, 12 holds the
+	// floor until the gap times out.
+	r.advance([]int64{13}, now)
+	if r.floor != 11 {
+		t.Fatalf("floor moved past gap 12 early: %d", r.floor)
+	}
+	r.advance(nil, now.Add(30*time.Second))
+	if r.floor != 11 {
+		t.Fatalf("floor moved past gap 12 before the timeout: %d", r.floor)
+	}
+	r.advance(nil, now.Add(time.Minute))
+	if r.floor != 13 || len(r.gaps) != 0 || len(r.delivered) != 0 {
+		t.Fatalf("expected floor 13 after the gap timed out, got floor %d delivered %v gaps %v", r.floor, r.delivered, r.gaps)
+	}
+}
+
+// Test that a checkpoint carries the floor and the ids delivered above it, so
+// a reader resumed from it neither repeats nor skips rows.
+func TestUpdatesReaderCheckpoint(t *testing.T) {
+	r := &updatesReader{floor: 9}
+	r.advance([]int64{12, 11}, time.Now())
+	pos := r.checkpoint()
+	if pos != "9,11,12" {
+		t.Fatalf("unexpected checkpoint %q", pos)
+	}
+
+	other := &updatesReader{floor: 3}
+	if err := other.resume(pos); err != nil {
+		t.Fatal(err)
+	}
+	if other.floor != 9 || !other.delivered[11] || !other.delivered[12] || !other.resumed {
+		t.Fatalf("resume did not restore the position: floor %d delivered %v", other.floor, other.delivered)
+	}
+	for _, bad := range []string{"", "x", "9,8", "9,a"} {
+		if err := other.resume(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
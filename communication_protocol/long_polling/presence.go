@@ -0,0 +1,156 @@
+package long_polling
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"time"
+)
+
+// PresenceTopic is the topic presence events are delivered on. Only
+// subscriptions that list it by name receive them; wildcards and topic-less
+// subscriptions do not, so clients that never asked are not woken up.
+const PresenceTopic = "presence"
+
+// PresenceEvent is the JSON payload of a presence update.
+type PresenceEvent struct {
+	Type     string    `json:"type"` // "join" or "leave"
+	ClientID string    `json:"clientID"`
+	At       time.Time `json:"at"`
+}
+
+// ClientPresence describes an online client.
+type ClientPresence struct {
+	ClientID      string             `json:"clientID"`
+	LastSeen      time.Time          `json:"lastSeen"`
+	Connected     bool               `json:"connected"` // Holds a subscription right now, rather than being between polls
+	Subscriptions []SubscriptionInfo `json:"subscriptions"`
+}
+
+// SubscriptionInfo describes one live subscription.
+type SubscriptionInfo struct {
+	ID     uint64   `json:"id"`
+	Topics []string `json:"topics,omitempty"` // Empty means every topic
+}
+
+// presence is the state of an online client. A long-polling client has no
+// subscription between polls, so it only goes offline once it has held none
+// for the grace period.
+type presence struct {
+	lastSeen time.Time
+	leave    *time.Timer // Pending leave while the client has no subscriptions
+	gen      uint64      // Invalidates a leave timer that fired too late to be stopped
+}
+
+// WithPresence enables presence tracking. A client joins when it first
+// subscribes and leaves once it has had no subscription for grace, which
+// should comfortably exceed the gap between a client's polls. Join and leave
+// events are delivered live on PresenceTopic but never logged, so they are
+// not part of any backlog.
+func WithPresence(grace time.Duration) Option {
+	return func(cm *ClientManager) {
+		cm.presence = make(map[string]*presence)
+		cm.presenceGrace = grace
+	}
+}
+
+// markSeenLocked records activity from clientID, publishing a join event if
+// it was offline.
+func (cm *ClientManager) markSeenLocked(clientID string) []Drop {
+	if cm.presence == nil {
+		return nil
+	}
+	now := time.Now()
+	p, ok := cm.presence[clientID]
+	if ok {
+		p.lastSeen = now
+		if p.leave != nil {
+			p.leave.Stop()
+			p.leave = nil
+			p.gen++
+		}
+		return nil
+	}
+	cm.presence[clientID] = &presence{lastSeen: now}
+	return cm.publishPresenceLocked(nil, "join", clientID, now)
+}
+
+// scheduleLeaveLocked starts the grace period after clientID's last
+// subscription ended.
+func (cm *ClientManager) scheduleLeaveLocked(clientID string) {
+	p, ok := cm.presence[clientID]
+	if !ok {
+		return
+	}
+	p.lastSeen = time.Now()
+	if p.leave != nil {
+		return
+	}
+	p.gen++
+	gen := p.gen
+	p.leave = time.AfterFunc(cm.presenceGrace, func() {
+		cm.expire(clientID, p, gen)
+	})
+}
+
+// expire marks clientID offline if it has not come back since the leave
+// timer for gen was started.
+func (cm *ClientManager) expire(clientID string, p *presence, gen uint64) {
+	cm.mu.Lock()
+	if cm.presence[clientID] != p || p.gen != gen || len(cm.clients[clientID]) > 0 {
+		cm.mu.Unlock()
+		return
+	}
+	delete(cm.presence, clientID)
+	drops := cm.publishPresenceLocked(nil, "leave", clientID, time.Now())
+	cm.mu.Unlock()
+	cm.reportDrops(drops)
+}
+
+func (cm *ClientManager) publishPresenceLocked(drops []Drop, kind, clientID string, at time.Time) []Drop {
+	data, _ := json.Marshal(PresenceEvent{Type: kind, ClientID: clientID, At: at})
+	// Presence is per replica and only of interest live, so events are not
+	// logged. They carry the log head as their ID: resuming from it skips
+	// nothing, and in a cluster the shared IDs stay the same on every replica.
+	u := Update{ID: cm.log.LastID(), Topic: PresenceTopic, Data: string(data)}
+	return cm.deliverLocked(drops, u, slices.Contains[[]string])
+}
+
+// Online reports whether clientID is currently online. It is always false
+// when presence tracking is disabled.
+func (cm *ClientManager) Online(clientID string) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	_, ok := cm.presence[clientID]
+	return ok
+}
+
+// Presence lists online clients, sorted by client ID, with their live
+// subscriptions.
+func (cm *ClientManager) Presence() []ClientPresence {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	list := make([]ClientPresence, 0, len(cm.presence))
+	for clientID, p := range cm.presence {
+		cp := ClientPresence{
+			ClientID:      clientID,
+			LastSeen:      p.lastSeen,
+			Connected:     len(cm.clients[clientID]) > 0,
+			Subscriptions: []SubscriptionInfo{},
+		}
+		for _, sub := range cm.clients[clientID] {
+			cp.Subscriptions = append(cp.Subscriptions, SubscriptionInfo{
+				ID:     sub.ID,
+				Topics: append([]string(nil), sub.topics...),
+			})
+		}
+		sort.Slice(cp.Subscriptions, func(i, j int) bool { return cp.Subscriptions[i].ID < cp.Subscriptions[j].ID })
+		if cp.Connected {
+			cp.LastSeen = time.Now() // Streaming clients are being seen right now
+		}
+		list = append(list, cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ClientID < list[j].ClientID })
+	return list
+}
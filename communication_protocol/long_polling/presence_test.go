@@ -0,0 +1,131 @@
+package long_polling
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// nextPresence waits for a presence event on sub.
+func nextPresence(t *testing.T, sub *Subscription, within time.Duration) PresenceEvent {
+	t.Helper()
+	select {
+	case u := <-sub.Updates():
+		var ev PresenceEvent
+		if err := json.Unmarshal([]byte(u.Data), &ev); err != nil {
+			t.Fatalf("failed to decode presence event %q: %v", u.Data, err)
+		}
+		return ev
+	case <-time.After(within):
+		t.Fatalf("no presence event within %v", within)
+		return PresenceEvent{}
+	}
+}
+
+func TestPresenceJoinLeaveWithGrace(t *testing.T) {
+	grace := 100 * time.Millisecond
+	cm := NewClientManager(WithPresence(grace))
+	watcher, _ := cm.Subscribe("watcher", 0, PresenceTopic)
+
+	poll, _ := cm.Subscribe("poller", 0)
+	if ev := nextPresence(t, watcher, time.Second); ev.Type != "join" || ev.ClientID != "poller" {
+		t.Fatalf("expected poller to join, got %+v", ev)
+	}
+
+	// Re-polling within the grace period keeps the client online silently.
+	cm.Unsubscribe(poll)
+	time.Sleep(grace / 2)
+	poll, _ = cm.Subscribe("poller", 0, "orders.*")
+	cm.Unsubscribe(poll)
+	time.Sleep(grace / 2)
+	if !cm.Online("poller") {
+		t.Fatalf("expected poller to still be online")
+	}
+	select {
+	case u := <-watcher.Updates():
+		t.Fatalf("expected no presence event between polls, got %q", u.Data)
+	default:
+	}
+
+	list := cm.Presence()
+	if len(list) != 2 || list[0].ClientID != "poller" || list[0].Connected || !list[1].Connected {
+		t.Fatalf("unexpected presence list %+v", list)
+	}
+	if subs := list[1].Subscriptions; len(subs) != 1 || subs[0].Topics[0] != PresenceTopic {
+		t.Fatalf("expected the watcher's subscription to be listed, got %+v", subs)
+	}
+
+	if ev := nextPresence(t, watcher, time.Second); ev.Type != "leave" || ev.ClientID != "poller" {
+		t.Fatalf("expected poller to leave, got %+v", ev)
+	}
+	if cm.Online("poller") {
+		t.Fatalf("expected poller to be offline after the grace period")
+	}
+}
+
+func TestPresenceDisabledByDefault(t *testing.T) {
+	cm := NewClientManager()
+	sub, _ := cm.Subscribe("c1", 0)
+	other, _ := cm.Subscribe("c2", 0)
+	defer cm.Unsubscribe(other)
+	cm.Unsubscribe(sub)
+
+	select {
+	case u := <-other.Updates():
+		t.Fatalf("expected no presence events, got %q", u.Data)
+	default:
+	}
+	if cm.Online("c2") || len(cm.Presence()) != 0 {
+		t.Fatalf("expected no presence tracking without WithPresence")
+	}
+}
+
+// Test that presence events are delivered live but not logged, so they never
+// use up sequence numbers or show up in a backlog.
+func TestPresenceEventsAreNotLogged(t *testing.T) {
+	cm := NewClientManager(WithPresence(time.Minute))
+	cm.Publish("orders", "o1")
+	watcher, _ := cm.Subscribe("watcher", 0, PresenceTopic)
+	defer cm.Unsubscribe(watcher)
+
+	sub, _ := cm.Subscribe("c1", 0)
+	defer cm.Unsubscribe(sub)
+	select {
+	case u := <-watcher.Updates():
+		if u.ID != 1 {
+			t.Fatalf("expected the join to carry the log head 1, got %d", u.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no join event")
+	}
+
+	if u := cm.log.Append("orders", "o2"); u.ID != 2 {
+		t.Fatalf("expected presence events not to use IDs, next was %d", u.ID)
+	}
+	_, backlog := cm.Subscribe("late", 1, PresenceTopic)
+	if len(backlog.Updates) != 0 {
+		t.Fatalf("expected no presence events in the backlog, got %+v", backlog.Updates)
+	}
+}
+
+// Test that presence events only reach subscriptions that name the presence
+// topic, not topic-less or wildcard ones.
+func TestPresenceRequiresExplicitTopic(t *testing.T) {
+	cm := NewClientManager(WithPresence(time.Minute))
+	all, _ := cm.Subscribe("all", 0)
+	wildcard, _ := cm.Subscribe("wildcard", 0, "#")
+	watcher, _ := cm.Subscribe("watcher", 0, PresenceTopic)
+
+	sub, _ := cm.Subscribe("c1", 0)
+	defer cm.Unsubscribe(sub)
+	if ev := nextPresence(t, watcher, time.Second); ev.Type != "join" || ev.ClientID != "c1" {
+		t.Fatalf("expected c1 to join, got %+v", ev)
+	}
+	for name, s := range map[string]*Subscription{"topic-less": all, "wildcard": wildcard} {
+		select {
+		case u := <-s.Updates():
+			t.Fatalf("%s subscription received presence event %q", name, u.Data)
+		default:
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package long_polling
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultBusChannel is the Redis channel replicas exchange update batches on.
+const DefaultBusChannel = "long_polling:bus"
+
+// RedisBus is a Bus over Redis pub/sub. Each batch is sent as one JSON
+// message on a single channel, so every replica sees batches in the same order.
+type RedisBus struct {
+	client  *redis.Client
+	channel string
+	sub     *subscription
+}
+
+// NewRedisBus creates a bus on channel (DefaultBusChannel if empty).
+func NewRedisBus(client *redis.Client, channel string) *RedisBus {
+	if channel == "" {
+		channel = DefaultBusChannel
+	}
+	return &RedisBus{client: client, channel: channel, sub: &subscription{
+		name: fmt.Sprintf("%q", channel),
+		open: func(ctx context.Context) *redis.PubSub {
+			return client.Subscribe(ctx, channel)
+		},
+	}}
+}
+
+// Publish sends a batch to every replica.
+func (b *RedisBus) Publish(ctx context.Context, msgs []Message) error {
+	payload, err := json.Marshal(msgs)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %w", err)
+	}
+	return b.client.Publish(ctx, b.channel, payload).Err()
+}
+
+// Next waits for a batch from the bus and returns it together with any others
+// already received.
+func (b *RedisBus) Next(ctx context.Context) ([]Message, error) {
+	return b.sub.next(ctx, func(m *redis.Message) ([]Message, error) {
+		var msgs []Message
+		if err := json.Unmarshal([]byte(m.Payload), &msgs); err != nil {
+			return nil, fmt.Errorf("failed to decode batch: %w", err)
+		}
+		return msgs, nil
+	})
+}
+
+// Close releases the pub/sub connection. Next fails afterwards.
+func (b *RedisBus) Close() error {
+	return b.sub.close()
+}
+
+// DefaultStateKey is the Redis hash holding the shared ClusterState.
+const DefaultStateKey = "long_polling:state"
+
+// RedisClusterState is a ClusterState stored in a Redis hash: the last
+// reserved ID under "id" and the source position under "position".
+type RedisClusterState struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedisClusterState creates state stored at key (DefaultStateKey if empty).
+func NewRedisClusterState(client *redis.Client, key string) *RedisClusterState {
+	if key == "" {
+		key = DefaultStateKey
+	}
+	return &RedisClusterState{client: client, key: key}
+}
+
+func (s *RedisClusterState) Reserve(ctx context.Context, n int) (uint64, error) {
+	last, err := s.client.HIncrBy(ctx, s.key, "id", int64(n)).Result()
+	return uint64(last), err
+}
+
+func (s *RedisClusterState) Position(ctx context.Context) (string, error) {
+	pos, err := s.client.HGet(ctx, s.key, "position").Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return pos, err
+}
+
+func (s *RedisClusterState) SavePosition(ctx context.Context, pos string) error {
+	return s.client.HSet(ctx, s.key, "position", pos).Err()
+}
+
+// DefaultLeaderKey is the Redis key used for the leader lock.
+const DefaultLeaderKey = "long_polling:leader"
+
+// Scripts only touch the key when it still holds our token, so a replica
+// whose lease expired can never extend or delete the new leader's lock.
+var (
+	renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+// RedisLock is a LeaderLock stored in a single Redis key with a TTL.
+type RedisLock struct {
+	client *redis.Client
+	key    string
+	token  string // Unique per replica
+	ttl    time.Duration
+}
+
+// NewRedisLock creates a lock on key (DefaultLeaderKey if empty). If the
+// holder stops renewing, the lock expires after ttl.
+func NewRedisLock(client *redis.Client, key string, ttl time.Duration) (*RedisLock, error) {
+	if key == "" {
+		key = DefaultLeaderKey
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	return &RedisLock{client: client, key: key, token: hex.EncodeToString(b[:]), ttl: ttl}, nil
+}
+
+func (l *RedisLock) Acquire(ctx context.Context) (bool, error) {
+	return l.client.SetNX(ctx, l.key, l.token, l.ttl).Result()
+}
+
+func (l *RedisLock) Renew(ctx context.Context) (bool, error) {
+	n, err := renewScript.Run(ctx, l.client, []string{l.key}, l.token, l.ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (l *RedisLock) Release(ctx context.Context) error {
+	return releaseScript.Run(ctx, l.client, []string{l.key}, l.token).Err()
+}
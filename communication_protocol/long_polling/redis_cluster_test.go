@@ -0,0 +1,92 @@
+package long_polling
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test that a batch published on the bus reaches every replica's bus in one
+// piece, IDs included.
+func TestRedisBusRoundTrip(t *testing.T) {
+	client := newTestRedis(t)
+	a, b := NewRedisBus(client, ""), NewRedisBus(client, "")
+	defer a.Close()
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	got := make(chan []Message, 1)
+	go func() {
+		batch, _ := b.Next(ctx)
+		got <- batch
+	}()
+	want := []Message{{ID: 7, Topic: "t", Data: "one"}, {ID: 8, Data: "two"}}
+	for {
+		if n, _ := client.PubSubNumSub(ctx, DefaultBusChannel).Result(); n[DefaultBusChannel] > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := a.Publish(ctx, want); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	batch := <-got
+	if len(batch) != 2 || batch[0] != want[0] || batch[1] != want[1] {
+		t.Fatalf("expected %+v, got %+v", want, batch)
+	}
+}
+
+// Test that Close may race with a blocked Next, which then fails. Run with
+// -race.
+func TestRedisBusConcurrentClose(t *testing.T) {
+	client := newTestRedis(t)
+	bus := NewRedisBus(client, "")
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := bus.Next(context.Background())
+		errs <- err
+	}()
+	for {
+		if n, _ := client.PubSubNumSub(context.Background(), DefaultBusChannel).Result(); n[DefaultBusChannel] > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("expected Next to fail after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Next did not return after Close")
+	}
+}
+
+// Test that IDs are reserved in consecutive ranges and the position is shared
+// between state values on the same key.
+func TestRedisClusterState(t *testing.T) {
+	client := newTestRedis(t)
+	ctx := context.Background()
+	a, b := NewRedisClusterState(client, ""), NewRedisClusterState(client, "")
+
+	if pos, err := a.Position(ctx); err != nil || pos != "" {
+		t.Fatalf("expected no position yet, got %q, %v", pos, err)
+	}
+	if last, err := a.Reserve(ctx, 3); err != nil || last != 3 {
+		t.Fatalf("expected IDs up to 3, got %d, %v", last, err)
+	}
+	if last, err := b.Reserve(ctx, 2); err != nil || last != 5 {
+		t.Fatalf("expected IDs up to 5, got %d, %v", last, err)
+	}
+	if err := a.SavePosition(ctx, "41,43"); err != nil {
+		t.Fatal(err)
+	}
+	if pos, err := b.Position(ctx); err != nil || pos != "41,43" {
+		t.Fatalf("expected the saved position, got %q, %v", pos, err)
+	}
+}
@@ -0,0 +1,145 @@
+package long_polling
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisSource reads updates from Redis pub/sub. The Redis channel a message
+// was published on becomes its topic. Redis pub/sub is fire-and-forget:
+// messages published while the source is disconnected are not redelivered.
+type RedisSource struct {
+	sub *subscription
+}
+
+// NewRedisSource creates a source subscribed to the given channels or patterns.
+func NewRedisSource(client *redis.Client, channels ...string) *RedisSource {
+	return &RedisSource{sub: &subscription{
+		name: fmt.Sprint(channels),
+		open: func(ctx context.Context) *redis.PubSub {
+			return client.PSubscribe(ctx, channels...)
+		},
+	}}
+}
+
+// Next waits for a message and returns it together with any others already received.
+func (s *RedisSource) Next(ctx context.Context) ([]Message, error) {
+	return s.sub.next(ctx, func(m *redis.Message) ([]Message, error) {
+		return []Message{{Topic: m.Channel, Data: m.Payload}}, nil
+	})
+}
+
+// Close unsubscribes and releases the pub/sub connection. Next fails
+// afterwards.
+func (s *RedisSource) Close() error {
+	return s.sub.close()
+}
+
+// subscription is a Redis pub/sub subscription opened by the first Next. If
+// its message channel closes it is reopened; only close ends it for good. Next
+// and close may be called concurrently.
+type subscription struct {
+	name string                                  // Channels subscribed to, for errors
+	open func(ctx context.Context) *redis.PubSub // Subscribes to the channels
+
+	mu       sync.Mutex
+	pubsub   *redis.PubSub
+	messages <-chan *redis.Message
+	closed   bool
+}
+
+// channel returns the message channel, subscribing first if needed.
+func (s *subscription) channel(ctx context.Context) (<-chan *redis.Message, error) {
+	s.mu.Lock()
+	messages, closed := s.messages, s.closed
+	s.mu.Unlock()
+	if closed {
+		return nil, fmt.Errorf("redis subscription to %s closed", s.name)
+	}
+	if messages != nil {
+		return messages, nil
+	}
+
+	// Subscribe without holding the lock so close is not held up.
+	pubsub := s.open(ctx)
+	// Wait for the subscription to be confirmed so errors surface here.
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", s.name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		pubsub.Close()
+		return nil, fmt.Errorf("redis subscription to %s closed", s.name)
+	}
+	s.pubsub, s.messages = pubsub, pubsub.Channel()
+	return s.messages, nil
+}
+
+// reset drops messages, which was found closed, so the next call to channel
+// subscribes again.
+func (s *subscription) reset(messages <-chan *redis.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.messages != messages {
+		return
+	}
+	s.pubsub.Close()
+	s.pubsub, s.messages = nil, nil
+}
+
+// next waits for a message and returns it decoded together with any others
+// already received.
+func (s *subscription) next(ctx context.Context, decode func(*redis.Message) ([]Message, error)) ([]Message, error) {
+	for {
+		messages, err := s.channel(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var batch []Message
+		select {
+		case m, ok := <-messages:
+			if !ok {
+				s.reset(messages)
+				continue
+			}
+			if batch, err = decode(m); err != nil {
+				return nil, err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		for {
+			select {
+			case m, ok := <-messages:
+				if !ok {
+					s.reset(messages)
+					return batch, nil
+				}
+				msgs, err := decode(m)
+				if err != nil {
+					return batch, err
+				}
+				batch = append(batch, msgs...)
+			default:
+				return batch, nil
+			}
+		}
+	}
+}
+
+// close releases the pub/sub connection and ends the subscription.
+func (s *subscription) close() error {
+	s.mu.Lock()
+	pubsub := s.pubsub
+	s.pubsub, s.messages, s.closed = nil, nil, true
+	s.mu.Unlock()
+	if pubsub == nil {
+		return nil
+	}
+	return pubsub.Close()
+}
@@ -0,0 +1,142 @@
+package long_polling
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Test that messages on channels matching the patterns arrive with the
+// channel as their topic, and that others are ignored.
+func TestRedisSourcePatterns(t *testing.T) {
+	client := newTestRedis(t)
+	src := NewRedisSource(client, "orders.*")
+	defer src.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	got := make(chan []Message, 1)
+	errs := make(chan error, 1)
+	go func() {
+		batch, err := src.Next(ctx)
+		if err != nil {
+			errs <- err
+			return
+		}
+		got <- batch
+	}()
+
+	// Publish until the subscription is in place; earlier messages are lost,
+	// as with real Redis pub/sub.
+	for {
+		client.Publish(ctx, "users.created", "ignored")
+		if n, _ := client.Publish(ctx, "orders.created", "o1").Result(); n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case batch := <-got:
+		if len(batch) == 0 || batch[0].Topic != "orders.created" || batch[0].Data != "o1" {
+			t.Fatalf("unexpected batch %+v", batch)
+		}
+		for _, m := range batch {
+			if m.Topic != "orders.created" {
+				t.Fatalf("received message on unsubscribed channel: %+v", m)
+			}
+		}
+	case err := <-errs:
+		t.Fatalf("Next: %v", err)
+	}
+}
+
+// Test that Next subscribes again when the pub/sub channel closes under it,
+// rather than failing for good.
+func TestRedisSourceResubscribes(t *testing.T) {
+	client := newTestRedis(t)
+	src := NewRedisSource(client, "orders.*")
+	defer src.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, data := range []string{"o1", "o2"} {
+		got := make(chan error, 1)
+		go func() {
+			// Skip anything left over from the previous round.
+			for {
+				batch, err := src.Next(ctx)
+				if err != nil || slices.ContainsFunc(batch, func(m Message) bool { return m.Data == data }) {
+					got <- err
+					return
+				}
+			}
+		}()
+		// Publish until Next returns: the closed subscription may still be
+		// counted as a receiver for a moment.
+	publish:
+		for {
+			client.Publish(ctx, "orders.created", data)
+			select {
+			case err := <-got:
+				if err != nil {
+					t.Fatalf("Next: %v", err)
+				}
+				break publish
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+
+		// Close the underlying pub/sub, as if it had failed.
+		src.sub.mu.Lock()
+		src.sub.pubsub.Close()
+		src.sub.mu.Unlock()
+	}
+}
+
+// Test that Close may race with a blocked Next, which then fails instead of
+// resubscribing. Run with -race.
+func TestRedisSourceConcurrentClose(t *testing.T) {
+	client := newTestRedis(t)
+	src := NewRedisSource(client, "orders.*")
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := src.Next(context.Background())
+		errs <- err
+	}()
+	for {
+		if n, _ := client.PubSubNumPat(context.Background()).Result(); n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("expected Next to fail after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Next did not return after Close")
+	}
+	if _, err := src.Next(context.Background()); err == nil {
+		t.Fatal("expected Next to fail after Close")
+	}
+	if err := src.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package long_polling
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Topics are dot-separated segments such as "orders.created". Subscription
+// patterns may use "*" to match exactly one segment ("orders.*" matches
+// "orders.created") and a trailing "#" to match zero or more segments
+// ("orders.#" matches "orders", "orders.created" and "orders.eu.paid").
+const (
+	topicSeparator = "."
+	wildcardOne    = "*"
+	wildcardRest   = "#"
+)
+
+// ValidateTopicPattern checks that a subscription pattern is well formed.
+func ValidateTopicPattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("empty topic pattern")
+	}
+	segments := strings.Split(pattern, topicSeparator)
+	for i, seg := range segments {
+		switch {
+		case seg == "":
+			return fmt.Errorf("topic pattern %q has an empty segment", pattern)
+		case seg == wildcardRest && i != len(segments)-1:
+			return fmt.Errorf("topic pattern %q: %q is only allowed as the last segment", pattern, wildcardRest)
+		case seg != wildcardOne && seg != wildcardRest &&
+			strings.ContainsAny(seg, wildcardOne+wildcardRest):
+			return fmt.Errorf("topic pattern %q: wildcards must be a whole segment", pattern)
+		}
+	}
+	return nil
+}
+
+// MatchTopic reports whether topic matches pattern.
+func MatchTopic(pattern, topic string) bool {
+	if pattern == topic {
+		return true
+	}
+	ps := strings.Split(pattern, topicSeparator)
+	ts := strings.Split(topic, topicSeparator)
+	for i, p := range ps {
+		if p == wildcardRest {
+			return true
+		}
+		if i >= len(ts) {
+			return false
+		}
+		if p != wildcardOne && p != ts[i] {
+			return false
+		}
+	}
+	return len(ps) == len(ts)
+}
+
+// matchAny reports whether topic matches at least one of patterns. An empty
+// pattern list means "everything", which keeps topic-less clients working.
+func matchAny(patterns []string, topic string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if MatchTopic(p, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// PatternCovers reports whether every topic matched by pattern is also matched
+// by allowed, e.g. "orders.#" covers "orders.*.paid" but "orders.*" does not
+// cover "orders.#".
+func PatternCovers(allowed, pattern string) bool {
+	as := strings.Split(allowed, topicSeparator)
+	ps := strings.Split(pattern, topicSeparator)
+	for i, a := range as {
+		if a == wildcardRest {
+			return true
+		}
+		if i >= len(ps) {
+			return false
+		}
+		switch {
+		case ps[i] == wildcardRest:
+			return false
+		case a == wildcardOne:
+			// Covers a literal segment or another "*"
+		case a != ps[i]:
+			return false
+		}
+	}
+	return len(as) == len(ps)
+}
+
+// AuthorizeTopics checks requested subscription patterns against the
+// patterns a client is allowed, returning the patterns to subscribe with.
+// An empty allowed list permits nothing; "#" permits everything. An empty
+// request ("everything") is kept when "#" is allowed and otherwise narrowed to
+// the allowed patterns rather than rejected.
+func AuthorizeTopics(allowed, requested []string) ([]string, error) {
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("not allowed to subscribe to any topic")
+	}
+	if len(requested) == 0 {
+		if slices.Contains(allowed, "#") {
+			return nil, nil
+		}
+		return append([]string(nil), allowed...), nil
+	}
+	for _, p := range requested {
+		covered := false
+		for _, a := range allowed {
+			if PatternCovers(a, p) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return nil, fmt.Errorf("not allowed to subscribe to %q", p)
+		}
+	}
+	return requested, nil
+}
@@ -0,0 +1,90 @@
+package long_polling
+
+import (
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.paid", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders", false},
+		{"orders.*", "orders.eu.created", false},
+		{"*.created", "orders.created", true},
+		{"orders.#", "orders", true},
+		{"orders.#", "orders.eu.created", true},
+		{"orders.#", "payments.created", false},
+		{"#", "anything.at.all", true},
+	}
+	for _, c := range cases {
+		if got := MatchTopic(c.pattern, c.topic); got != c.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", c.pattern, c.topic, got, c.want)
+		}
+	}
+}
+
+func TestValidateTopicPattern(t *testing.T) {
+	for _, p := range []string{"orders", "orders.*", "orders.#", "*.created"} {
+		if err := ValidateTopicPattern(p); err != nil {
+			t.Errorf("expected %q to be valid, got %v", p, err)
+		}
+	}
+	for _, p := range []string{"", "orders.", "orders..created", "orders.#.created", "orders.cre*"} {
+		if err := ValidateTopicPattern(p); err == nil {
+			t.Errorf("expected %q to be rejected", p)
+		}
+	}
+}
+
+func TestPatternCovers(t *testing.T) {
+	cases := []struct {
+		allowed, pattern string
+		want             bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.*", true},
+		{"orders.*", "orders.#", false},
+		{"orders.created", "orders.*", false},
+		{"orders.#", "orders.*.paid", true},
+		{"orders.#", "orders", true},
+		{"orders.#", "payments.*", false},
+		{"#", "anything.#", true},
+		{"*.created", "orders.created.eu", false},
+	}
+	for _, c := range cases {
+		if got := PatternCovers(c.allowed, c.pattern); got != c.want {
+			t.Errorf("PatternCovers(%q, %q) = %v, want %v", c.allowed, c.pattern, got, c.want)
+		}
+	}
+}
+
+func TestAuthorizeTopics(t *testing.T) {
+	allowed := []string{"orders.#", "prices.*"}
+
+	got, err := AuthorizeTopics(allowed, nil)
+	if err != nil || len(got) != 2 {
+		t.Fatalf("expected an empty request to narrow to %v, got %v (%v)", allowed, got, err)
+	}
+	if _, err := AuthorizeTopics(allowed, []string{"orders.eu.paid", "prices.btc"}); err != nil {
+		t.Fatalf("expected covered patterns to be allowed, got %v", err)
+	}
+	if _, err := AuthorizeTopics(allowed, []string{"prices.#"}); err == nil {
+		t.Fatalf("expected a broader pattern to be rejected")
+	}
+	if got, err := AuthorizeTopics([]string{"#"}, []string{"anything"}); err != nil || got[0] != "anything" {
+		t.Fatalf("expected no restriction, got %v (%v)", got, err)
+	}
+	if got, err := AuthorizeTopics([]string{"#"}, nil); err != nil || got != nil {
+		t.Fatalf("expected an empty request to stay every topic, got %v (%v)", got, err)
+	}
+	for _, requested := range [][]string{nil, {"anything"}} {
+		if got, err := AuthorizeTopics(nil, requested); err == nil {
+			t.Fatalf("expected no allowed topics to reject %v, got %v", requested, got)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package long_polling
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultLogSize is the number of updates retained by a ClientManager's log.
+const DefaultLogSize = 1024
+
+// UpdateLog is a bounded, in-memory log of broadcast updates. Every update gets
+// the next sequence number, so a client that remembers the last ID it saw can
+// ask for everything after it. Once full, the oldest updates are overwritten.
+//
+// Updates may also be stored under IDs assigned elsewhere (see AppendAt), in
+// which case IDs only increase and can skip numbers this log never saw.
+type UpdateLog struct {
+	mu     sync.RWMutex
+	buf    []Update // Ring buffer, in ID order
+	start  int      // Index of the oldest retained update
+	size   int
+	lastID uint64
+	floor  uint64 // Updates with IDs up to here may exist but are not retained
+}
+
+// NewUpdateLog creates a log that retains the most recent capacity updates.
+func NewUpdateLog(capacity int) *UpdateLog {
+	if capacity <= 0 {
+		capacity = DefaultLogSize
+	}
+	return &UpdateLog{buf: make([]Update, capacity)}
+}
+
+// Append stamps an update with the next sequence number and stores it.
+func (l *UpdateLog) Append(topic, data string) Update {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u := Update{ID: l.lastID + 1, Topic: topic, Data: data}
+	l.storeLocked(u)
+	return u
+}
+
+// AppendAt stores an update under an ID assigned elsewhere, such as by a
+// cluster leader. IDs skipped since the last update count as not retained.
+// It reports false, storing nothing, if id is not newer than the log head.
+func (l *UpdateLog) AppendAt(id uint64, topic, data string) (Update, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if id <= l.lastID {
+		return Update{}, false
+	}
+	if id > l.lastID+1 {
+		l.floor = id - 1
+	}
+	u := Update{ID: id, Topic: topic, Data: data}
+	l.storeLocked(u)
+	return u, true
+}
+
+func (l *UpdateLog) storeLocked(u Update) {
+	l.lastID = u.ID
+	if l.size == len(l.buf) {
+		l.floor = max(l.floor, l.buf[l.start].ID)
+		l.buf[l.start] = u
+		l.start = (l.start + 1) % len(l.buf)
+	} else {
+		l.buf[(l.start+l.size)%len(l.buf)] = u
+		l.size++
+	}
+}
+
+// LastID returns the sequence number of the most recent update, or 0 if empty.
+func (l *UpdateLog) LastID() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lastID
+}
+
+// Since returns the retained updates with IDs greater than cursor, oldest
+// first. truncated reports that some updates after cursor are no longer
+// retained, or that cursor is ahead of the log (e.g. after a server restart),
+// in which case the cursor is meaningless and every retained update is
+// returned.
+func (l *UpdateLog) Since(cursor uint64) (updates []Update, truncated bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if cursor == l.lastID {
+		return nil, false
+	}
+	if cursor > l.lastID {
+		cursor, truncated = 0, true
+	}
+	at := func(i int) Update { return l.buf[(l.start+i)%len(l.buf)] }
+	from := sort.Search(l.size, func(i int) bool { return at(i).ID > cursor })
+	updates = make([]Update, l.size-from)
+	for i := range updates {
+		updates[i] = at(from + i)
+	}
+	return updates, truncated || cursor < l.floor
+}
@@ -0,0 +1,75 @@
+package long_polling
+
+import (
+	"testing"
+)
+
+// Test that Since returns everything after the cursor in order, and reports
+// truncation once the ring buffer has overwritten updates the cursor needs.
+func TestUpdateLogSinceAndWraparound(t *testing.T) {
+	l := NewUpdateLog(3)
+
+	for _, msg := range []string{"a", "b"} {
+		l.Append("", msg)
+	}
+	got, truncated := l.Since(0)
+	if truncated || len(got) != 2 || got[0].Data != "a" || got[1].ID != 2 {
+		t.Fatalf("expected [a b] untruncated, got %+v truncated=%v", got, truncated)
+	}
+
+	for _, msg := range []string{"c", "d", "e"} {
+		l.Append("", msg)
+	}
+	// Retained now: c(3) d(4) e(5).
+	got, truncated = l.Since(3)
+	if truncated || len(got) != 2 || got[0].Data != "d" || got[1].Data != "e" {
+		t.Fatalf("expected [d e] untruncated, got %+v truncated=%v", got, truncated)
+	}
+	got, truncated = l.Since(1)
+	if !truncated || len(got) != 3 || got[0].Data != "c" {
+		t.Fatalf("expected truncated [c d e], got %+v truncated=%v", got, truncated)
+	}
+	if got, truncated = l.Since(5); truncated || len(got) != 0 {
+		t.Fatalf("expected nothing after head, got %+v truncated=%v", got, truncated)
+	}
+	if got, truncated = l.Since(42); !truncated || len(got) != 3 || got[0].Data != "c" {
+		t.Fatalf("expected a cursor ahead of the log to return everything retained, truncated, got %+v truncated=%v", got, truncated)
+	}
+	if got, truncated = NewUpdateLog(3).Since(42); !truncated || len(got) != 0 {
+		t.Fatalf("expected a cursor ahead of an empty log to be reported as truncated, got %+v truncated=%v", got, truncated)
+	}
+}
+
+// Test that updates stored under externally assigned IDs keep them, and that
+// IDs the log skipped over are reported as truncation.
+func TestUpdateLogAppendAt(t *testing.T) {
+	l := NewUpdateLog(3)
+
+	if _, ok := l.AppendAt(10, "", "a"); !ok {
+		t.Fatalf("expected the first update to be stored")
+	}
+	l.AppendAt(11, "", "b")
+	if _, ok := l.AppendAt(11, "", "dup"); ok {
+		t.Fatalf("expected a repeated ID to be ignored")
+	}
+	l.AppendAt(15, "", "c")
+
+	got, truncated := l.Since(10)
+	if !truncated || len(got) != 2 || got[0].ID != 11 || got[1].ID != 15 {
+		t.Fatalf("expected truncated [11 15], got %+v truncated=%v", got, truncated)
+	}
+	if got, truncated = l.Since(14); truncated || len(got) != 1 || got[0].Data != "c" {
+		t.Fatalf("expected [c] untruncated, got %+v truncated=%v", got, truncated)
+	}
+	if got, truncated = l.Since(9); !truncated || len(got) != 3 {
+		t.Fatalf("expected every update, truncated, got %+v truncated=%v", got, truncated)
+	}
+
+	if u := l.Append("", "d"); u.ID != 16 {
+		t.Fatalf("expected Append to continue from 16, got %d", u.ID)
+	}
+	// Retained now: b(11) c(15) d(16).
+	if got, truncated = l.Since(11); !truncated || len(got) != 2 {
+		t.Fatalf("expected [c d] truncated by the skipped IDs, got %+v truncated=%v", got, truncated)
+	}
+}
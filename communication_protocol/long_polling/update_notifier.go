@@ -1,52 +1,103 @@
 package long_polling
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
 	"log"
 	"time"
-
-	_ "github.com/lib/pq" // For PostgreSQL example
 )
 
+// Message is a single update read from an UpdateSource, before it is stamped
+// with a sequence number by the ClientManager. A ClusterNotifier leader stamps
+// messages itself before putting them on the bus, so every replica logs them
+// under the same ID.
+type Message struct {
+	ID    uint64 `json:"id,omitempty"` // Assigned by a cluster leader; 0 from sources
+	Topic string `json:"topic,omitempty"`
+	Data  string `json:"data"`
+}
+
+// UpdateSource is where an UpdateNotifier reads updates from. Implementations
+// may poll (e.g. a database table) or be pushed to (e.g. a message broker).
+type UpdateSource interface {
+	// Next blocks until at least one new update is available or ctx is done,
+	// and returns every update available at that point, oldest first. On an
+	// error it may still return the updates it read before the error; they
+	// are published.
+	Next(ctx context.Context) ([]Message, error)
+}
+
+// Acker is implemented by sources that need to know when the updates
+// returned by Next have been published, e.g. to commit a consumer offset
+// only then. Ack acknowledges everything Next has returned so far; updates
+// that were never acknowledged may be delivered again after a restart.
+type Acker interface {
+	Ack()
+}
+
+// Checkpointer is implemented by sources that can save and restore how far
+// they have read, so a ClusterNotifier's new leader continues from where the
+// previous leader stopped rather than from its own, possibly stale, position.
+type Checkpointer interface {
+	// Checkpoint returns the position just after the last batch Next returned.
+	Checkpoint() string
+	// Resume makes Next continue from a position returned by Checkpoint.
+	Resume(pos string) error
+}
+
+// Stopper is implemented by sources that hold something only the replica
+// reading them should, such as partitions of a Kafka consumer group. A
+// ClusterNotifier stops its source when it steps down as leader, so the new
+// leader can take it over; the next call to Next starts the source again.
+type Stopper interface {
+	Stop() error
+}
+
 type UpdateNotifier struct {
 	clientManager *ClientManager
-	db            *sql.DB // Add database connection
-	interval      time.Duration
+	source        UpdateSource
+	retryInterval time.Duration // Wait after a source error before retrying
 	stopChan      chan struct{}
 }
 
-// NewUpdateNotifier creates a new UpdateNotifier with a database connection.
-func NewUpdateNotifier(cm *ClientManager, db *sql.DB, interval time.Duration) *UpdateNotifier {
+// NewUpdateNotifier creates a new UpdateNotifier that publishes everything
+// source produces to cm.
+func NewUpdateNotifier(cm *ClientManager, source UpdateSource) *UpdateNotifier {
 	return &UpdateNotifier{
 		clientManager: cm,
-		db:            db,
-		interval:      interval,
+		source:        source,
+		retryInterval: 5 * time.Second,
 		stopChan:      make(chan struct{}),
 	}
 }
 
-// Start begins the periodic database checking.
+// Start reads batches from the source and publishes them until Stop is called.
 func (un *UpdateNotifier) Start() {
-	ticker := time.NewTicker(un.interval)
-	defer ticker.Stop()
-
-	lastChecked := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-un.stopChan
+		cancel()
+	}()
 
 	for {
-		select {
-		case <-ticker.C:
-			update, err := un.checkDatabaseForUpdates(lastChecked)
-			if err != nil {
-				log.Printf("Error checking database for updates: %v", err)
-				continue
+		batch, err := un.source.Next(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		// Updates read before an error were already consumed from the source.
+		if len(batch) > 0 {
+			un.clientManager.PublishBatch(batch)
+			if acker, ok := un.source.(Acker); ok {
+				acker.Ack()
 			}
-			if update != "" {
-				un.clientManager.BroadcastUpdate(update)
+		}
+		if err != nil {
+			log.Printf("Error reading updates: %v", err)
+			select {
+			case <-time.After(un.retryInterval):
+			case <-ctx.Done():
+				return
 			}
-			lastChecked = time.Now()
-		case <-un.stopChan:
-			return
 		}
 	}
 }
@@ -55,50 +106,3 @@ func (un *UpdateNotifier) Start() {
 func (un *UpdateNotifier) Stop() {
 	close(un.stopChan)
 }
-
-// checkDatabaseForUpdates is a placeholder for actual database checking logic.
-// It should query your database for changes since the lastChecked time.
-// For demonstration, it simulates a check.
-func (un *UpdateNotifier) checkDatabaseForUpdates(lastChecked time.Time) (string, error) {
-	// This expects a table like:
-	//   CREATE TABLE updates (
-	//     id SERIAL PRIMARY KEY,
-	//     message TEXT NOT NULL,
-	//     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-	//   );
-
-	rows, err := un.db.Query(
-		`SELECT message, created_at
-         FROM updates
-         WHERE created_at > $1
-         ORDER BY created_at ASC`,
-		lastChecked,
-	)
-	if err != nil {
-		return "", fmt.Errorf("failed to query database: %w", err)
-	}
-	defer rows.Close()
-
-	var latestMsg string
-	var latestTime time.Time
-
-	for rows.Next() {
-		var msg string
-		var createdAt time.Time
-		if err := rows.Scan(&msg, &createdAt); err != nil {
-			return "", fmt.Errorf("failed to scan row: %w", err)
-		}
-		latestMsg = msg
-		latestTime = createdAt
-	}
-
-	if err := rows.Err(); err != nil {
-		return "", fmt.Errorf("row iteration error: %w", err)
-	}
-
-	if latestMsg == "" {
-		return "", nil
-	}
-
-	return fmt.Sprintf("New data: %s (at %s)", latestMsg, latestTime.Format(time.RFC3339)), nil
-}
@@ -0,0 +1,71 @@
+package long_polling
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test that every message in a batch is published, in order, rather than
+// only the latest one.
+func TestUpdateNotifierPublishesWholeBatch(t *testing.T) {
+	cm := NewClientManager()
+	sub, _ := cm.Subscribe("c1", 0)
+	defer cm.Unsubscribe(sub)
+
+	source := NewMemorySource()
+	notifier := NewUpdateNotifier(cm, source)
+	go notifier.Start()
+	defer notifier.Stop()
+
+	source.Push(Message{Data: "first"}, Message{Data: "second"})
+	source.Push(Message{Topic: "orders.created", Data: "third"})
+
+	for _, want := range []string{"first", "second", "third"} {
+		select {
+		case u := <-sub.Updates():
+			if u.Data != want {
+				t.Fatalf("expected %q, got %q", want, u.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("did not receive %q", want)
+		}
+	}
+}
+
+// failingSource returns its batch together with an error, like a bus that
+// fails to decode a message after reading others.
+type failingSource struct {
+	batch []Message
+	done  bool
+}
+
+func (s *failingSource) Next(ctx context.Context) ([]Message, error) {
+	if s.done {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	s.done = true
+	return s.batch, errors.New("decode failed")
+}
+
+// Test that updates returned alongside an error are still published.
+func TestUpdateNotifierPublishesPartialBatch(t *testing.T) {
+	cm := NewClientManager()
+	sub, _ := cm.Subscribe("c1", 0)
+	defer cm.Unsubscribe(sub)
+
+	notifier := NewUpdateNotifier(cm, &failingSource{batch: []Message{{Data: "kept"}}})
+	go notifier.Start()
+	defer notifier.Stop()
+
+	select {
+	case u := <-sub.Updates():
+		if u.Data != "kept" {
+			t.Fatalf("expected %q, got %q", "kept", u.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("partial batch was not published")
+	}
+}
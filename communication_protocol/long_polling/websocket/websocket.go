@@ -0,0 +1,495 @@
+// Package websocket is a small RFC 6455 implementation: the opening
+// handshake, frame encoding/decoding with masking and fragmentation,
+// ping/pong, and the close handshake.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Opcodes defined by RFC 6455 section 5.2.
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// Close codes defined by RFC 6455 section 7.4.1.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	CloseMessageTooBig   = 1009
+)
+
+// acceptGUID is appended to Sec-WebSocket-Key when computing Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	maxControlPayload = 125
+	closeTimeout      = 5 * time.Second
+)
+
+// DefaultMaxMessageSize bounds a reassembled message; larger ones are rejected with 1009.
+var DefaultMaxMessageSize int64 = 1 << 20
+
+// ErrClosed is returned when writing to a connection after the close handshake started.
+var ErrClosed = errors.New("websocket: connection closed")
+
+// CloseError is returned by ReadMessage when the peer sends a close frame.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Reason)
+}
+
+// Conn is a WebSocket connection. ReadMessage must only be called from one
+// goroutine; writes are safe for concurrent use.
+type Conn struct {
+	conn     net.Conn
+	br       *bufio.Reader
+	isServer bool
+
+	// MaxMessageSize caps the size of a reassembled message.
+	MaxMessageSize int64
+	// PongHandler, if set, is called with the payload of every pong received.
+	PongHandler func(data string)
+
+	readMu     sync.Mutex // Held for the duration of ReadMessage
+	writeMu    sync.Mutex
+	closeSent  bool
+	closeOnce  sync.Once
+	closeRecvd chan struct{}
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, isServer bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+	return &Conn{
+		conn:           conn,
+		br:             br,
+		isServer:       isServer,
+		MaxMessageSize: DefaultMaxMessageSize,
+		closeRecvd:     make(chan struct{}),
+	}
+}
+
+// Upgrade performs the server side of the opening handshake and hijacks the
+// HTTP connection. On failure an HTTP error has already been written.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, errors.New("websocket: method not GET")
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return nil, errors.New("websocket: missing upgrade headers")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: invalid key")
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("websocket: response does not support hijacking")
+	}
+	netConn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: hijack failed: %w", err)
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	if _, err := netConn.Write([]byte(resp)); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: failed to write handshake: %w", err)
+	}
+	return newConn(netConn, brw.Reader, true), nil
+}
+
+// Dial opens a client connection to a ws:// URL. It is mainly used by tests
+// and load tools; TLS (wss://) is not supported.
+func Dial(ctx context.Context, rawURL string) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+
+	var d net.Dialer
+	netConn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		netConn.SetDeadline(deadline)
+	}
+	if err := req.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: failed to write handshake: %w", err)
+	}
+
+	br := bufio.NewReader(netConn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: failed to read handshake: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != AcceptKey(key) {
+		netConn.Close()
+		return nil, fmt.Errorf("websocket: handshake failed: %s", resp.Status)
+	}
+	netConn.SetDeadline(time.Time{})
+	return newConn(netConn, br, false), nil
+}
+
+// AcceptKey computes the Sec-WebSocket-Accept value for a client key.
+func AcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next complete text or binary message, reassembling
+// fragments. Pings are answered automatically and pongs passed to PongHandler.
+// A close frame from the peer is echoed and reported as a *CloseError.
+func (c *Conn) ReadMessage() (opcode int, payload []byte, err error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	return c.readMessage()
+}
+
+func (c *Conn) readMessage() (opcode int, payload []byte, err error) {
+	var (
+		msgOp int
+		msg   []byte
+	)
+	for {
+		fin, op, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case OpPing:
+			if err := c.writeFrame(OpPong, data); err != nil && err != ErrClosed {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			if c.PongHandler != nil {
+				c.PongHandler(string(data))
+			}
+			continue
+		case OpClose:
+			return 0, nil, c.handleClose(data)
+		case OpText, OpBinary:
+			if msgOp != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "new message before previous finished")
+			}
+			msgOp = op
+		case OpContinuation:
+			if msgOp == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+		}
+
+		if int64(len(msg)+len(data)) > c.MaxMessageSize {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		msg = append(msg, data...)
+		if !fin {
+			continue
+		}
+		if msgOp == OpText && !utf8.Valid(msg) {
+			return 0, nil, c.fail(CloseInvalidPayload, "invalid utf-8")
+		}
+		return msgOp, msg, nil
+	}
+}
+
+// readFrame reads a single frame and unmasks its payload.
+func (c *Conn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = hdr[0]&0x80 != 0
+	if hdr[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	opcode = int(hdr[0] & 0x0F)
+	masked := hdr[1]&0x80 != 0
+	length := int64(hdr[1] & 0x7F)
+
+	if c.isServer && !masked {
+		return false, 0, nil, c.fail(CloseProtocolError, "client frames must be masked")
+	}
+	if !c.isServer && masked {
+		return false, 0, nil, c.fail(CloseProtocolError, "server frames must not be masked")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if opcode >= OpClose {
+		if !fin || length > maxControlPayload {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+		}
+	}
+	if length < 0 || length > c.MaxMessageSize {
+		return false, 0, nil, c.fail(CloseMessageTooBig, "frame too big")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+func maskBytes(mask [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i%4]
+	}
+}
+
+// handleClose replies to a peer-initiated close (or completes our own) and
+// closes the underlying connection.
+func (c *Conn) handleClose(data []byte) error {
+	ce := &CloseError{Code: CloseNoStatus}
+	if len(data) >= 2 {
+		ce.Code = int(binary.BigEndian.Uint16(data[:2]))
+		ce.Reason = string(data[2:])
+	}
+	c.closeOnce.Do(func() { close(c.closeRecvd) })
+
+	reply := CloseNormal
+	if ce.Code != CloseNoStatus {
+		reply = ce.Code
+	}
+	c.writeClose(reply, "")
+	c.conn.Close()
+	return ce
+}
+
+// fail starts a close handshake with the given code and returns an error
+// describing the protocol violation.
+func (c *Conn) fail(code int, reason string) error {
+	c.writeClose(code, reason)
+	c.conn.Close()
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// WriteMessage sends a single unfragmented text or binary message.
+func (c *Conn) WriteMessage(opcode int, data []byte) error {
+	if opcode != OpText && opcode != OpBinary {
+		return fmt.Errorf("websocket: invalid message opcode %d", opcode)
+	}
+	return c.writeFrame(opcode, data)
+}
+
+// WritePing sends a ping control frame.
+func (c *Conn) WritePing(data []byte) error {
+	return c.writeFrame(OpPing, data)
+}
+
+func (c *Conn) writeFrame(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return ErrClosed
+	}
+	if opcode == OpClose {
+		c.closeSent = true
+	}
+	return c.writeFrameLocked(opcode, payload)
+}
+
+func (c *Conn) writeFrameLocked(opcode int, payload []byte) error {
+	buf := make([]byte, 0, 14+len(payload))
+	buf = append(buf, 0x80|byte(opcode))
+
+	maskBit := byte(0)
+	if !c.isServer {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, maskBit|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, maskBit|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	}
+
+	if c.isServer {
+		buf = append(buf, payload...)
+	} else {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		buf = append(buf, mask[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(mask, buf[start:])
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+func (c *Conn) writeClose(code int, reason string) error {
+	data := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > maxControlPayload-2 {
+		reason = reason[:maxControlPayload-2]
+	}
+	data = append(data, reason...)
+	return c.writeFrame(OpClose, data)
+}
+
+// Close performs the closing handshake: it sends a close frame, waits for the
+// peer's close frame, and then closes the TCP connection. If another goroutine
+// is blocked in ReadMessage that reader observes the reply; otherwise Close
+// reads (and discards) frames itself until the reply or a timeout.
+func (c *Conn) Close(code int, reason string) error {
+	if err := c.writeClose(code, reason); err != nil {
+		c.conn.Close()
+		if err == ErrClosed {
+			return nil
+		}
+		return err
+	}
+	if c.readMu.TryLock() {
+		c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+		for {
+			if _, _, err := c.readMessage(); err != nil {
+				break
+			}
+		}
+		c.readMu.Unlock()
+	} else {
+		select {
+		case <-c.closeRecvd:
+		case <-time.After(closeTimeout):
+		}
+	}
+	if err := c.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// SetReadDeadline sets the deadline for future ReadMessage calls.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// RemoteAddr returns the peer's network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
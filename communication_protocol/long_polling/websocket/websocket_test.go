@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The example key and accept value from RFC 6455 section 1.3.
+func TestAcceptKey(t *testing.T) {
+	got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ==")
+	if want := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func newEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		for {
+			op, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(op, data); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func dialTest(t *testing.T, srv *httptest.Server) *Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, err := Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	return conn
+}
+
+// Test that text and large binary messages round-trip through masking and
+// the 16/64-bit length encodings.
+func TestEchoRoundTrip(t *testing.T) {
+	srv := newEchoServer(t)
+	defer srv.Close()
+	conn := dialTest(t, srv)
+
+	cases := []struct {
+		op   int
+		data []byte
+	}{
+		{OpText, []byte("hello")},
+		{OpBinary, make([]byte, 300)},
+		{OpBinary, make([]byte, 70000)},
+	}
+	for _, c := range cases {
+		if err := conn.WriteMessage(c.op, c.data); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if op != c.op || len(data) != len(c.data) {
+			t.Fatalf("expected op %d len %d, got op %d len %d", c.op, len(c.data), op, len(data))
+		}
+	}
+}
+
+// Test that a ping is answered with a pong carrying the same payload, and
+// that the close handshake reports the server's echoed close code.
+func TestPingPongAndClose(t *testing.T) {
+	srv := newEchoServer(t)
+	defer srv.Close()
+	conn := dialTest(t, srv)
+
+	pong := make(chan string, 1)
+	conn.PongHandler = func(data string) { pong <- data }
+
+	if err := conn.WritePing([]byte("are-you-there")); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+	// Pongs are consumed inside ReadMessage, so send a message to read past it.
+	if err := conn.WriteMessage(OpText, []byte("after-ping")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "after-ping" {
+		t.Fatalf("expected echo after ping, got %q, %v", data, err)
+	}
+	select {
+	case got := <-pong:
+		if got != "are-you-there" {
+			t.Fatalf("expected pong payload %q, got %q", "are-you-there", got)
+		}
+	default:
+		t.Fatalf("did not receive pong")
+	}
+
+	if err := conn.writeClose(CloseNormal, "bye"); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	_, _, err := conn.ReadMessage()
+	var ce *CloseError
+	if !errors.As(err, &ce) || ce.Code != CloseNormal {
+		t.Fatalf("expected close %d, got %v", CloseNormal, err)
+	}
+}
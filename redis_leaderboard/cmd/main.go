@@ -1,17 +1,25 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	redis_leaderboard "github.com/poeticcode01/poc/redis_leaderboard"
 )
 
-var lb *redis_leaderboard.Leaderboard
+// defaultBoard is the board the unprefixed routes (/score, /top, ...) use.
+const defaultBoard = "default"
+
+var registry *redis_leaderboard.Registry
 
 func main() {
 	rdb := redis.NewClient(&redis.Options{
@@ -19,16 +27,45 @@ func main() {
 	})
 	defer rdb.Close()
 
-	lb = redis_leaderboard.NewLeaderboard(rdb, "leaderboard:scores")
+	registry = redis_leaderboard.NewRegistry(rdb, "leaderboard")
+	// Before named boards, every score lived in leaderboard:scores.
+	if moved, err := registry.ImportKey(context.Background(), "leaderboard:scores", defaultBoard); err != nil {
+		log.Printf("Not migrating leaderboard:scores to the default board: %v", err)
+	} else if moved {
+		log.Printf("Migrated leaderboard:scores to the %q board", defaultBoard)
+	}
+	if _, err := registry.Create(context.Background(), defaultBoard, redis_leaderboard.BoardSettings{}); err != nil && !errors.Is(err, redis_leaderboard.ErrBoardExists) {
+		log.Fatalf("Failed to create the default board: %v", err)
+	}
+	if len(os.Args) > 1 {
+		if err := runCommand(context.Background(), os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/score", handleSubmitScore)
-	mux.HandleFunc("/score/incr", handleIncrementScore)
-	mux.HandleFunc("/top", handleTopN)
-	mux.HandleFunc("/rank/", handleGetRank)
-	mux.HandleFunc("/around/", handleGetAround)
-	mux.HandleFunc("/count", handleCount)
-	mux.HandleFunc("/remove/", handleRemove)
+	mux.HandleFunc("/boards", handleBoards)
+	mux.HandleFunc("/boards/{name}", handleBoard)
+	for _, prefix := range []string{"", "/boards/{name}"} {
+		mux.HandleFunc(prefix+"/score", handleSubmitScore)
+		mux.HandleFunc(prefix+"/score/incr", handleIncrementScore)
+		mux.HandleFunc(prefix+"/top", handleTopN)
+		mux.HandleFunc(prefix+"/rank/{member}", handleGetRank)
+		mux.HandleFunc(prefix+"/around/{member}", handleGetAround)
+		mux.HandleFunc(prefix+"/count", handleCount)
+		mux.HandleFunc(prefix+"/friends", handleFriends)
+		mux.HandleFunc(prefix+"/list", handleList)
+		mux.HandleFunc(prefix+"/range", handleScoreRange)
+		mux.HandleFunc(prefix+"/percentile/{member}", handlePercentile)
+		mux.HandleFunc(prefix+"/ranks", handleGetRanks)
+		mux.HandleFunc(prefix+"/meta/{member}", handleMetadata)
+		mux.HandleFunc(prefix+"/rollover", handleRollover)
+		mux.HandleFunc(prefix+"/seasons", handleSeasons)
+		mux.HandleFunc(prefix+"/snapshot", handleSnapshot)
+		mux.HandleFunc(prefix+"/remove/{member}", handleRemove)
+		mux.HandleFunc(prefix+"/periods/{period}", handlePeriods)
+	}
 
 	log.Println("Leaderboard POC started, listening on :8080")
 	if err := http.ListenAndServe(":8080", logRequest(mux)); err != nil {
@@ -50,11 +87,238 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
+// boardFor returns the board named in the path, or the default board for
+// the unprefixed routes. It writes the error response itself.
+func boardFor(w http.ResponseWriter, r *http.Request) (*redis_leaderboard.Leaderboard, bool) {
+	name := r.PathValue("name")
+	if name == "" {
+		name = defaultBoard
+	}
+	board, err := registry.Board(r.Context(), name)
+	if err != nil {
+		writeBoardError(w, err)
+		return nil, false
+	}
+	return board, true
+}
+
+// viewFor is boardFor for read-only routes: ?ranking=ordinal|competition|dense
+// overrides how the response numbers tied ranks, ?season= selects an archived
+// season, and ?period=daily|weekly|monthly selects that ranking, for the
+// current period or the one given by ?id= (e.g. 2024-05-31, 2024-W22, 2024-05).
+func viewFor(w http.ResponseWriter, r *http.Request) (*redis_leaderboard.Leaderboard, bool) {
+	board, ok := boardFor(w, r)
+	if !ok {
+		return nil, false
+	}
+	if s := r.URL.Query().Get("ranking"); s != "" {
+		mode, err := redis_leaderboard.ParseRankMode(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+		board = board.RankedBy(mode)
+	}
+	if season := r.URL.Query().Get("season"); season != "" {
+		var err error
+		if board, err = board.Season(season); err != nil {
+			writeBoardError(w, err)
+			return nil, false
+		}
+	}
+	ps := r.URL.Query().Get("period")
+	if ps == "" {
+		return board, true
+	}
+	period, err := redis_leaderboard.ParsePeriod(ps)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	at := time.Now()
+	if id := r.URL.Query().Get("id"); id != "" && period != redis_leaderboard.AllTime {
+		if at, err = redis_leaderboard.ParsePeriodID(period, id); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	view, err := board.Period(period, at)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return view, true
+}
+
+// handlePeriods lists the retained periods of one kind for a board.
+func handlePeriods(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	board, ok := boardFor(w, r)
+	if !ok {
+		return
+	}
+	period, err := redis_leaderboard.ParsePeriod(r.PathValue("period"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ids, err := board.RetainedPeriods(r.Context(), period)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"period":  period,
+		"current": redis_leaderboard.PeriodID(period, time.Now()),
+		"ids":     ids,
+	})
+}
+
+// queryInt returns a non-negative integer query value, or 0 if it is missing
+// or invalid.
+func queryInt(r *http.Request, name string) int64 {
+	v, err := strconv.ParseInt(r.URL.Query().Get(name), 10, 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
+
+// pageQuery reads ?offset=&limit=&token= for the paginated routes.
+func pageQuery(r *http.Request) redis_leaderboard.PageQuery {
+	return redis_leaderboard.PageQuery{
+		Offset: queryInt(r, "offset"),
+		Limit:  queryInt(r, "limit"),
+		Token:  r.URL.Query().Get("token"),
+	}
+}
+
+// splitList splits a comma-separated query value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// writeBoardError maps leaderboard errors to status codes.
+func writeBoardError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, redis_leaderboard.ErrBoardNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, redis_leaderboard.ErrBoardExists),
+		errors.Is(err, redis_leaderboard.ErrSeasonExists),
+		errors.Is(err, redis_leaderboard.ErrEmptyBoard):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, redis_leaderboard.ErrInvalidBoardName),
+		errors.Is(err, redis_leaderboard.ErrScoreOutOfRange),
+		errors.Is(err, redis_leaderboard.ErrReadOnly),
+		errors.Is(err, redis_leaderboard.ErrInvalidPageToken),
+		errors.Is(err, redis_leaderboard.ErrInvalidSeason),
+		errors.Is(err, redis_leaderboard.ErrInvalidGroup):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// handleBoards lists boards (GET) or creates one (POST ?name=).
+func handleBoards(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		boards, err := registry.List(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"boards": boards})
+	case http.MethodPost:
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "name required", http.StatusBadRequest)
+			return
+		}
+		var settings redis_leaderboard.BoardSettings
+		for _, s := range splitList(r.URL.Query().Get("periods")) {
+			p, err := redis_leaderboard.ParsePeriod(s)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			settings.Periods = append(settings.Periods, p)
+		}
+		order, err := redis_leaderboard.ParseOrder(r.URL.Query().Get("order"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		settings.Order = order
+		tieBreak, err := redis_leaderboard.ParseTieBreak(r.URL.Query().Get("tieBreak"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		settings.TieBreak = tieBreak
+		if settings.Submit, err = redis_leaderboard.ParseSubmitMode(r.URL.Query().Get("submit")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if settings.Ranking, err = redis_leaderboard.ParseRankMode(r.URL.Query().Get("ranking")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := registry.Create(r.Context(), name, settings); err != nil {
+			writeBoardError(w, err)
+			return
+		}
+		info, err := registry.Info(r.Context(), name)
+		if err != nil {
+			writeBoardError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, info)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleBoard describes (GET) or deletes (DELETE) a board.
+func handleBoard(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	switch r.Method {
+	case http.MethodGet:
+		info, err := registry.Info(r.Context(), name)
+		if err != nil {
+			writeBoardError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	case http.MethodDelete:
+		if err := registry.Delete(r.Context(), name); err != nil {
+			writeBoardError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"deleted": name})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 func handleSubmitScore(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	board, ok := boardFor(w, r)
+	if !ok {
+		return
+	}
 	member := r.URL.Query().Get("member")
 	scoreStr := r.URL.Query().Get("score")
 	if member == "" || scoreStr == "" {
@@ -66,12 +330,12 @@ func handleSubmitScore(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid score", http.StatusBadRequest)
 		return
 	}
-	rank, err := lb.SubmitScore(r.Context(), member, score)
+	result, err := board.SubmitScore(r.Context(), member, score)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeBoardError(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"member": member, "score": score, "rank": rank})
+	writeJSON(w, http.StatusOK, result)
 }
 
 func handleIncrementScore(w http.ResponseWriter, r *http.Request) {
@@ -79,6 +343,10 @@ func handleIncrementScore(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	board, ok := boardFor(w, r)
+	if !ok {
+		return
+	}
 	member := r.URL.Query().Get("member")
 	deltaStr := r.URL.Query().Get("delta")
 	if member == "" || deltaStr == "" {
@@ -90,9 +358,9 @@ func handleIncrementScore(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid delta", http.StatusBadRequest)
 		return
 	}
-	newScore, err := lb.IncrementScore(r.Context(), member, delta)
+	newScore, err := board.IncrementScore(r.Context(), member, delta)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeBoardError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"member": member, "score": newScore})
@@ -103,15 +371,25 @@ func handleTopN(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	board, ok := viewFor(w, r)
+	if !ok {
+		return
+	}
 	n := int64(10)
 	if s := r.URL.Query().Get("n"); s != "" {
 		if v, err := strconv.ParseInt(s, 10, 64); err == nil && v > 0 {
 			n = v
 		}
 	}
-	entries, err := lb.TopN(r.Context(), n)
+	var entries []redis_leaderboard.Entry
+	var err error
+	if r.URL.Query().Get("meta") == "true" {
+		entries, err = board.TopNWithMetadata(r.Context(), n)
+	} else {
+		entries, err = board.TopN(r.Context(), n)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeBoardError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"top": entries})
@@ -122,14 +400,18 @@ func handleGetRank(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	member := r.URL.Path[len("/rank/"):]
+	board, ok := viewFor(w, r)
+	if !ok {
+		return
+	}
+	member := r.PathValue("member")
 	if member == "" {
 		http.Error(w, "member required", http.StatusBadRequest)
 		return
 	}
-	rank, score, err := lb.GetRank(r.Context(), member)
+	rank, score, err := board.GetRank(r.Context(), member)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeBoardError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"member": member, "rank": rank, "score": score})
@@ -140,7 +422,11 @@ func handleGetAround(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	member := r.URL.Path[len("/around/"):]
+	board, ok := viewFor(w, r)
+	if !ok {
+		return
+	}
+	member := r.PathValue("member")
 	if member == "" {
 		http.Error(w, "member required", http.StatusBadRequest)
 		return
@@ -151,9 +437,9 @@ func handleGetAround(w http.ResponseWriter, r *http.Request) {
 			window = v
 		}
 	}
-	entries, err := lb.GetAround(r.Context(), member, window)
+	entries, err := board.GetAround(r.Context(), member, window)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeBoardError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"around": entries})
@@ -164,26 +450,192 @@ func handleCount(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	count, err := lb.TotalCount(r.Context())
+	board, ok := viewFor(w, r)
+	if !ok {
+		return
+	}
+	count, err := board.TotalCount(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeBoardError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"count": count})
 }
 
+// handleFriends ranks a group of members against each other: either the
+// listed ?members=a,b,c or the board's member group named by ?group=.
+func handleFriends(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	board, ok := viewFor(w, r)
+	if !ok {
+		return
+	}
+	offset, limit := queryInt(r, "offset"), queryInt(r, "limit")
+	members := splitList(r.URL.Query().Get("members"))
+	group := r.URL.Query().Get("group")
+	var page redis_leaderboard.FriendsPage
+	var err error
+	switch {
+	case len(members) > 0 && group != "":
+		http.Error(w, "members and group are mutually exclusive", http.StatusBadRequest)
+		return
+	case len(members) > 0:
+		page, err = board.Friends(r.Context(), members, offset, limit)
+	case group != "":
+		page, err = board.FriendsIn(r.Context(), group, offset, limit)
+	default:
+		http.Error(w, "members or group required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeBoardError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// handleList pages through the whole board.
+func handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	board, ok := viewFor(w, r)
+	if !ok {
+		return
+	}
+	page, err := board.List(r.Context(), pageQuery(r))
+	if err != nil {
+		writeBoardError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// handleScoreRange pages through the players scoring within ?min= and ?max=
+// (either may be omitted).
+func handleScoreRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	board, ok := viewFor(w, r)
+	if !ok {
+		return
+	}
+	minScore, maxScore := math.Inf(-1), math.Inf(1)
+	var err error
+	if s := r.URL.Query().Get("min"); s != "" {
+		if minScore, err = redis_leaderboard.ParseScore(s); err != nil {
+			http.Error(w, "invalid min", http.StatusBadRequest)
+			return
+		}
+	}
+	if s := r.URL.Query().Get("max"); s != "" {
+		if maxScore, err = redis_leaderboard.ParseScore(s); err != nil {
+			http.Error(w, "invalid max", http.StatusBadRequest)
+			return
+		}
+	}
+	page, err := board.GetByScoreRange(r.Context(), minScore, maxScore, pageQuery(r))
+	if err != nil {
+		writeBoardError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func handlePercentile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	board, ok := viewFor(w, r)
+	if !ok {
+		return
+	}
+	standing, err := board.Percentile(r.Context(), r.PathValue("member"))
+	if err != nil {
+		writeBoardError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, standing)
+}
+
+// handleGetRanks looks up ?members=a,b,c, with metadata, in one round trip.
+func handleGetRanks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	board, ok := viewFor(w, r)
+	if !ok {
+		return
+	}
+	members := splitList(r.URL.Query().Get("members"))
+	if len(members) == 0 {
+		http.Error(w, "members required", http.StatusBadRequest)
+		return
+	}
+	entries, err := board.GetRanks(r.Context(), members...)
+	if err != nil {
+		writeBoardError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ranks": entries})
+}
+
+// handleMetadata reads (GET) or replaces (PUT, JSON object body) a member's
+// metadata.
+func handleMetadata(w http.ResponseWriter, r *http.Request) {
+	board, ok := boardFor(w, r)
+	if !ok {
+		return
+	}
+	member := r.PathValue("member")
+	switch r.Method {
+	case http.MethodGet:
+		md, err := board.GetMetadata(r.Context(), member)
+		if err != nil {
+			writeBoardError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"member": member, "metadata": md})
+	case http.MethodPut:
+		var md redis_leaderboard.Metadata
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&md); err != nil {
+			http.Error(w, "invalid metadata: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := board.SetMetadata(r.Context(), member, md); err != nil {
+			writeBoardError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"member": member, "metadata": md})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 func handleRemove(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	member := r.URL.Path[len("/remove/"):]
+	board, ok := boardFor(w, r)
+	if !ok {
+		return
+	}
+	member := r.PathValue("member")
 	if member == "" {
 		http.Error(w, "member required", http.StatusBadRequest)
 		return
 	}
-	if err := lb.Remove(r.Context(), member); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := board.Remove(r.Context(), member); err != nil {
+		writeBoardError(w, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"removed": member})
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	redis_leaderboard "github.com/poeticcode01/poc/redis_leaderboard"
+)
+
+// runCommand runs a maintenance subcommand instead of the server:
+//
+//	rollover -board <name> -season <id> -out final.json|final.csv
+//	restore  -board <name> [-season <id>] -in final.json|final.csv
+func runCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	board := fs.String("board", defaultBoard, "board name")
+	season := fs.String("season", "", "season ID")
+	switch args[0] {
+	case "rollover":
+		out := fs.String("out", "", "snapshot file to write the final standings to (.json or .csv)")
+		fs.Parse(args[1:])
+		if *season == "" || *out == "" {
+			return fmt.Errorf("rollover needs -season and -out")
+		}
+		lb, err := registry.Board(ctx, *board)
+		if err != nil {
+			return err
+		}
+		archive, err := lb.Rollover(ctx, *season)
+		if err != nil {
+			return err
+		}
+		log.Printf("Archived season %q of board %q", *season, *board)
+		if err := exportSnapshot(ctx, archive, *out); err != nil {
+			return fmt.Errorf("season archived, but the export failed (retry with GET /boards/%s/snapshot?season=%s): %w", *board, *season, err)
+		}
+		log.Printf("Wrote final standings to %s", *out)
+		return nil
+	case "restore":
+		in := fs.String("in", "", "snapshot file to restore (.json or .csv)")
+		fs.Parse(args[1:])
+		if *in == "" {
+			return fmt.Errorf("restore needs -in")
+		}
+		lb, err := registry.Board(ctx, *board)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		snap, err := redis_leaderboard.ReadSnapshot(f)
+		if err != nil {
+			return err
+		}
+		if err := lb.Restore(ctx, snap, *season); err != nil {
+			return err
+		}
+		log.Printf("Restored %d entries from %s to board %q %s", len(snap.Entries), *in, *board, seasonLabel(*season))
+		return nil
+	}
+	return fmt.Errorf("unknown command %q (want rollover or restore)", args[0])
+}
+
+func seasonLabel(season string) string {
+	if season == "" {
+		return "(live)"
+	}
+	return "season " + season
+}
+
+// exportSnapshot writes lb's standings to path, as CSV if it ends in .csv
+// and JSON otherwise.
+func exportSnapshot(ctx context.Context, lb *redis_leaderboard.Leaderboard, path string) error {
+	snap, err := lb.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeSnapshot(f, snap, snapshotFormat(path)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func snapshotFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return "csv"
+	}
+	return "json"
+}
+
+func writeSnapshot(w io.Writer, snap redis_leaderboard.Snapshot, format string) error {
+	if format == "csv" {
+		return snap.WriteCSV(w)
+	}
+	return snap.WriteJSON(w)
+}
+
+// serveSnapshot sends snap as a download in the ?format= (json or csv).
+func serveSnapshot(w http.ResponseWriter, r *http.Request, snap redis_leaderboard.Snapshot) {
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "json":
+		format = "json"
+		w.Header().Set("Content-Type", "application/json")
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+	default:
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+	name := "standings"
+	if snap.Season != "" {
+		name = snap.Season
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+format))
+	if err := writeSnapshot(w, snap, format); err != nil {
+		log.Printf("Writing snapshot: %v", err)
+	}
+}
+
+// handleRollover archives the current season (?season=) and responds with
+// its final standings.
+func handleRollover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	board, ok := boardFor(w, r)
+	if !ok {
+		return
+	}
+	season := r.URL.Query().Get("season")
+	if season == "" {
+		http.Error(w, "season required", http.StatusBadRequest)
+		return
+	}
+	archive, err := board.Rollover(r.Context(), season)
+	if err != nil {
+		writeBoardError(w, err)
+		return
+	}
+	snap, err := archive.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveSnapshot(w, r, snap)
+}
+
+// handleSnapshot exports the standings of the board, or of a period or
+// archived season selected as for the other read routes.
+func handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	board, ok := viewFor(w, r)
+	if !ok {
+		return
+	}
+	snap, err := board.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveSnapshot(w, r, snap)
+}
+
+func handleSeasons(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	board, ok := boardFor(w, r)
+	if !ok {
+		return
+	}
+	seasons, err := board.Seasons(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"seasons": seasons})
+}
@@ -0,0 +1,109 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FriendsPage is one page of a leaderboard restricted to a group of members.
+type FriendsPage struct {
+	Entries []Entry `json:"entries"` // Ranked relative to each other, 1 = best in the group
+	Total   int64   `json:"total"`   // Members of the group that are on the board
+}
+
+// Friends ranks the given members relative to each other, e.g. a player and
+// their friends. Members not on the board are left out. Ranks follow the
+// board's order and RankMode; offset and limit select a page (limit <= 0
+// returns the rest).
+func (lb *Leaderboard) Friends(ctx context.Context, members []string, offset, limit int64) (FriendsPage, error) {
+	// ZMSCORE reports missing members as 0, so look the scores up one by one
+	// (still a single round trip).
+	pipe := lb.client.Pipeline()
+	cmds := make([]*redis.FloatCmd, len(members))
+	for i, m := range members {
+		cmds[i] = pipe.ZScore(ctx, lb.key, m)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return FriendsPage{}, err
+	}
+	seen := make(map[string]bool, len(members))
+	var zs []redis.Z
+	for i, cmd := range cmds {
+		s, err := cmd.Result()
+		if err == redis.Nil || seen[members[i]] {
+			continue
+		}
+		if err != nil {
+			return FriendsPage{}, err
+		}
+		seen[members[i]] = true
+		zs = append(zs, redis.Z{Score: s, Member: members[i]})
+	}
+	return lb.friendsPage(zs, offset, limit), nil
+}
+
+// ErrInvalidGroup is returned for group names that could not be used in a key.
+var ErrInvalidGroup = errors.New("invalid group")
+
+// GroupKey returns the key of the board's member group name: a Redis set (or
+// sorted set) of members that FriendsIn ranks, e.g. a player's friends. The
+// application fills it, with SADD for instance.
+func (lb *Leaderboard) GroupKey(name string) (string, error) {
+	if !boardNameRe.MatchString(name) {
+		return "", fmt.Errorf("%w %q: use 1-64 letters, digits, '-' or '_'", ErrInvalidGroup, name)
+	}
+	return lb.groupKey + name, nil
+}
+
+// FriendsIn is Friends for the members of the board's group name (see
+// GroupKey). Only groups in the board's own namespace can be read, and the
+// board is intersected with the group by a single ZINTER, so only the
+// group's entries leave Redis and nothing is written.
+func (lb *Leaderboard) FriendsIn(ctx context.Context, group string, offset, limit int64) (FriendsPage, error) {
+	groupKey, err := lb.GroupKey(group)
+	if err != nil {
+		return FriendsPage{}, err
+	}
+	zs, err := lb.client.ZInterWithScores(ctx, &redis.ZStore{
+		Keys:    []string{lb.key, groupKey},
+		Weights: []float64{1, 0}, // Keep the board's score
+	}).Result()
+	if err != nil {
+		return FriendsPage{}, err
+	}
+	return lb.friendsPage(zs, offset, limit), nil
+}
+
+// friendsPage sorts a group's stored scores the way Redis orders the board,
+// ranks them and cuts out one page.
+func (lb *Leaderboard) friendsPage(zs []redis.Z, offset, limit int64) FriendsPage {
+	sort.Slice(zs, func(i, j int) bool {
+		a, b := zs[i], zs[j]
+		if a.Score != b.Score {
+			return lb.better(a.Score, b.Score)
+		}
+		// Redis breaks ties by member name, reversed for descending ranges.
+		if lb.ascending() {
+			return a.Member.(string) < b.Member.(string)
+		}
+		return a.Member.(string) > b.Member.(string)
+	})
+	entries := make([]Entry, len(zs))
+	for i, z := range zs {
+		entries[i] = Entry{Member: z.Member.(string), Score: lb.decode(z.Score), Rank: int64(i) + 1}
+	}
+	lb.shareTiedRanks(entries)
+
+	page := FriendsPage{Total: int64(len(entries))}
+	offset = max(0, min(offset, page.Total))
+	end := page.Total
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	page.Entries = entries[offset:end]
+	return page
+}
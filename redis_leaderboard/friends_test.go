@@ -0,0 +1,53 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test that a group is read from the board's own namespace, ranked within
+// itself, and that the lookup writes nothing, so it works on read-only views.
+func TestFriendsInGroup(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	registry := NewRegistry(client, "")
+	lb, err := registry.Create(ctx, "arcade", BoardSettings{Periods: []Period{Daily}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	submitAll(t, lb, "alice", 10, "bob", 30, "carol", 20, "dave", 40)
+
+	key, err := lb.GroupKey("alice-friends")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "leaderboard:{arcade}:group:alice-friends" {
+		t.Fatalf("unexpected group key %q", key)
+	}
+	client.SAdd(ctx, key, "alice", "carol", "nobody")
+
+	page, err := lb.FriendsIn(ctx, "alice-friends", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || page.Entries[0].Member != "carol" || page.Entries[1].Rank != 2 {
+		t.Fatalf("unexpected page %+v", page)
+	}
+
+	today, _ := lb.Period(Daily, time.Now())
+	keys := client.Keys(ctx, "*").Val()
+	if page, err := today.FriendsIn(ctx, "alice-friends", 0, 1); err != nil || len(page.Entries) != 1 {
+		t.Fatalf("expected one entry from the daily view, got %+v, %v", page, err)
+	}
+	if after := client.Keys(ctx, "*").Val(); len(after) != len(keys) {
+		t.Fatalf("expected no keys to be written, had %v, now %v", keys, after)
+	}
+
+	for _, bad := range []string{"", "leaderboard:{arcade}:scores", "a*"} {
+		if _, err := lb.FriendsIn(ctx, bad, 0, 0); !errors.Is(err, ErrInvalidGroup) {
+			t.Fatalf("FriendsIn(%q): expected ErrInvalidGroup, got %v", bad, err)
+		}
+	}
+}
@@ -2,9 +2,13 @@ module github.com/poeticcode01/poc/redis_leaderboard
 
 go 1.23.0
 
-require github.com/redis/go-redis/v9 v9.7.0
+require (
+	github.com/alicebob/miniredis/v2 v2.39.0
+	github.com/redis/go-redis/v9 v9.7.0
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
 )
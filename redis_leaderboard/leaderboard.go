@@ -2,126 +2,188 @@ package redis_leaderboard
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"strconv"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 const defaultLeaderboardKey = "leaderboard:scores"
 
+// ErrReadOnly is returned when writing to a past-period view of a board.
+var ErrReadOnly = errors.New("leaderboard view is read-only")
+
 // Leaderboard uses Redis sorted set (score → member) for ranking.
-// Higher score = better rank. Same score: lexicographic order of member.
+// Higher score = better rank, unless the board is Ascending. Same score:
+// lexicographic order of member, unless a time-based TieBreak is configured.
 type Leaderboard struct {
-	client *redis.Client
-	key    string
+	client     *redis.Client
+	key        string
+	metaKey    string                   // Hash of member → Metadata JSON
+	groupKey   string                   // Prefix of the board's member groups (see FriendsIn)
+	periods    []Period                 // Time windows written alongside the all-time set
+	retention  map[Period]time.Duration // Overrides defaultRetention
+	order      Order                    // Which end of the set ranks first
+	tieBreak   TieBreak                 // Order of equal scores
+	rankMode   RankMode                 // How ties are numbered
+	submitMode SubmitMode               // Whether a submission replaces the current score
+	season     string                   // Set on Season views
+	readOnly   bool                     // Set on Period and Season views
 }
 
+// Option configures a Leaderboard.
+type Option func(*Leaderboard)
+
 // NewLeaderboard creates a leaderboard service backed by Redis sorted set.
-func NewLeaderboard(client *redis.Client, key string) *Leaderboard {
+func NewLeaderboard(client *redis.Client, key string, opts ...Option) *Leaderboard {
 	if key == "" {
 		key = defaultLeaderboardKey
 	}
-	return &Leaderboard{client: client, key: key}
+	lb := &Leaderboard{client: client, key: key, metaKey: key + ":meta", groupKey: key + ":group:"}
+	for _, opt := range opts {
+		opt(lb)
+	}
+	return lb
 }
 
 // Entry represents a single leaderboard entry (player + score).
 type Entry struct {
 	Member string  `json:"member"`
 	Score  float64 `json:"score"`
-	Rank   int64   `json:"rank"` // 1-based rank (1 = top)
+	Rank   int64   `json:"rank"` // 1-based rank (1 = top), numbered by the board's RankMode
+
+	Metadata Metadata `json:"metadata,omitempty"` // Only filled by the *WithMetadata and GetRanks calls
 }
 
-// SubmitScore sets or updates a member's score. Higher score wins.
-// Returns the member's new rank (1-based) and score.
-func (lb *Leaderboard) SubmitScore(ctx context.Context, member string, score float64) (rank int64, err error) {
-	pipe := lb.client.Pipeline()
-	pipe.ZAdd(ctx, lb.key, redis.Z{Score: score, Member: member})
-	pipe.ZRevRank(ctx, lb.key, member)
-	cmds, err := pipe.Exec(ctx)
+// SubmitScore sets or updates a member's score according to the board's
+// SubmitMode, and reports the member's rank and score before and after.
+// The read-modify-read runs in one MULTI/EXEC, so the previous and new
+// values are consistent. With periods enabled, the current day/week/month
+// sets are written in the same round trip.
+func (lb *Leaderboard) SubmitScore(ctx context.Context, member string, score float64) (SubmitResult, error) {
+	if lb.readOnly {
+		return SubmitResult{}, ErrReadOnly
+	}
+	stored, err := lb.encode(score, time.Now())
 	if err != nil {
-		return 0, err
+		return SubmitResult{}, err
+	}
+	z := redis.Z{Score: stored, Member: member}
+	pipe := lb.client.TxPipeline()
+	prevRank := lb.queueRank(ctx, pipe, lb.key, member)
+	prevScore := pipe.ZScore(ctx, lb.key, member)
+	changed := lb.queueSubmit(ctx, pipe, lb.key, z)
+	newRank := lb.queueRank(ctx, pipe, lb.key, member)
+	newScore := pipe.ZScore(ctx, lb.key, member)
+	lb.addToPeriods(ctx, pipe, func(key string) {
+		lb.queueSubmit(ctx, pipe, key, z)
+	})
+	// redis.Nil only means the member was not on the board before.
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return SubmitResult{}, err
 	}
-	// ZRevRank returns 0-based index; we want 1-based rank
-	r, _ := cmds[1].(*redis.IntCmd).Result()
-	return r + 1, nil
+
+	res := SubmitResult{
+		Member:  member,
+		Score:   lb.decode(newScore.Val()),
+		Updated: changed(),
+	}
+	if res.Rank, err = newRank(); err != nil {
+		return SubmitResult{}, err
+	}
+	if prevScore.Err() == nil {
+		if res.PreviousRank, err = prevRank(); err != nil {
+			return SubmitResult{}, err
+		}
+		res.PreviousScore = lb.decode(prevScore.Val())
+		res.Improved = lb.better(res.Score, res.PreviousScore)
+	} else {
+		res.Improved = true
+	}
+	return res, nil
 }
 
-// TopN returns the top n entries (highest scores first), 1-based rank.
+// TopN returns the top n entries (best scores first), 1-based rank.
 func (lb *Leaderboard) TopN(ctx context.Context, n int64) ([]Entry, error) {
 	if n <= 0 {
 		n = 10
 	}
 	stop := n - 1
-	results, err := lb.client.ZRevRangeWithScores(ctx, lb.key, 0, stop).Result()
+	results, err := lb.zrange(ctx, lb.client, lb.key, 0, stop).Result()
 	if err != nil {
 		return nil, err
 	}
-	entries := make([]Entry, len(results))
-	for i, z := range results {
-		member, _ := z.Member.(string)
-		entries[i] = Entry{
-			Member: member,
-			Score:  z.Score,
-			Rank:   int64(i) + 1,
-		}
-	}
-	return entries, nil
+	return lb.rankEntries(ctx, 0, results)
 }
 
 // GetRank returns 1-based rank and score for a member. 0 rank means not found.
+// With Competition or Dense ranking, tied members share a rank.
 func (lb *Leaderboard) GetRank(ctx context.Context, member string) (rank int64, score float64, err error) {
 	pipe := lb.client.Pipeline()
-	pipe.ZRevRank(ctx, lb.key, member)
-	pipe.ZScore(ctx, lb.key, member)
-	cmds, err := pipe.Exec(ctx)
-	if err != nil && err != redis.Nil {
+	rankOf := lb.queueRank(ctx, pipe, lb.key, member)
+	scoreCmd := pipe.ZScore(ctx, lb.key, member)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
 		return 0, 0, err
 	}
-	rankCmd := cmds[0].(*redis.IntCmd)
-	scoreCmd := cmds[1].(*redis.FloatCmd)
-	r, rErr := rankCmd.Result()
+	r, rErr := rankOf()
 	s, sErr := scoreCmd.Result()
-	if rErr == redis.Nil || sErr == redis.Nil {
-		return 0, 0, nil
-	}
 	if rErr != nil {
 		return 0, 0, rErr
 	}
+	if sErr == redis.Nil || r == 0 {
+		return 0, 0, nil
+	}
 	if sErr != nil {
 		return 0, 0, sErr
 	}
-	return r + 1, s, nil
+	return r, lb.decode(s), nil
 }
 
 // GetAround returns entries around a member's rank (e.g. "players near me").
 // halfWindow is how many above and below; total returned is at most 2*halfWindow+1.
 func (lb *Leaderboard) GetAround(ctx context.Context, member string, halfWindow int64) ([]Entry, error) {
-	rank, _, err := lb.GetRank(ctx, member)
-	if err != nil || rank <= 0 {
+	pos, err := lb.zrank(ctx, lb.client, lb.key, member).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
 		return nil, err
 	}
-	start := rank - halfWindow - 1
+	start := pos - halfWindow
 	if start < 0 {
 		start = 0
 	}
-	stop := rank + halfWindow - 1
-	results, err := lb.client.ZRevRangeWithScores(ctx, lb.key, start, stop).Result()
+	stop := pos + halfWindow
+	results, err := lb.zrange(ctx, lb.client, lb.key, start, stop).Result()
 	if err != nil {
 		return nil, err
 	}
-	entries := make([]Entry, len(results))
-	for i, z := range results {
-		m, _ := z.Member.(string)
-		entries[i] = Entry{Member: m, Score: z.Score, Rank: start + int64(i) + 1}
-	}
-	return entries, nil
+	return lb.rankEntries(ctx, start, results)
 }
 
 // IncrementScore adds delta to member's current score (useful for games).
-// If member doesn't exist, they are treated as 0. Returns new score.
+// If member doesn't exist, they are treated as 0. Returns new all-time score;
+// the current period sets are incremented by the same delta.
 func (lb *Leaderboard) IncrementScore(ctx context.Context, member string, delta float64) (newScore float64, err error) {
-	newScore, err = lb.client.ZIncrBy(ctx, lb.key, delta, member).Result()
-	return newScore, err
+	if lb.readOnly {
+		return 0, ErrReadOnly
+	}
+	if lb.timeTieBreak() && delta != math.Trunc(delta) {
+		return 0, fmt.Errorf("%w: delta %v must be a whole number", ErrScoreOutOfRange, delta)
+	}
+	now := time.Now()
+	pipe := lb.client.Pipeline()
+	result := lb.queueIncr(ctx, pipe, lb.key, member, delta, now)
+	lb.addToPeriods(ctx, pipe, func(key string) {
+		lb.queueIncr(ctx, pipe, key, member, delta, now)
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return result()
 }
 
 // TotalCount returns the number of members in the leaderboard.
@@ -129,9 +191,20 @@ func (lb *Leaderboard) TotalCount(ctx context.Context) (int64, error) {
 	return lb.client.ZCard(ctx, lb.key).Result()
 }
 
-// Remove removes a member from the leaderboard.
+// Remove removes a member from the leaderboard, including the current
+// period sets and its metadata. Past periods are left as they were.
 func (lb *Leaderboard) Remove(ctx context.Context, member string) error {
-	return lb.client.ZRem(ctx, lb.key, member).Err()
+	if lb.readOnly {
+		return ErrReadOnly
+	}
+	pipe := lb.client.Pipeline()
+	removeScript.Eval(ctx, pipe, denseKeys(lb.key), member, lb.bandScale())
+	pipe.HDel(ctx, lb.metaKey, member)
+	for _, pw := range lb.currentPeriods(time.Now()) {
+		removeScript.Eval(ctx, pipe, denseKeys(pw.key), member, lb.bandScale())
+	}
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
 // Score is a convenience to parse string scores; used by HTTP handlers.
@@ -0,0 +1,48 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestClient(t *testing.T) *redis.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// submitAll submits scores in order and fails the test on any error.
+func submitAll(t *testing.T, lb *Leaderboard, scores ...any) {
+	t.Helper()
+	for i := 0; i+1 < len(scores); i += 2 {
+		if _, err := lb.SubmitScore(context.Background(), scores[i].(string), float64(scores[i+1].(int))); err != nil {
+			t.Fatalf("SubmitScore(%v, %v): %v", scores[i], scores[i+1], err)
+		}
+	}
+}
+
+func TestTopNAndGetRank(t *testing.T) {
+	ctx := context.Background()
+	lb := NewLeaderboard(newTestClient(t), "test:scores")
+	submitAll(t, lb, "alice", 10, "bob", 30, "carol", 20)
+
+	top, err := lb.TopN(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].Member != "bob" || top[1].Member != "carol" || top[1].Rank != 2 {
+		t.Fatalf("unexpected top 2: %+v", top)
+	}
+	rank, score, err := lb.GetRank(ctx, "alice")
+	if err != nil || rank != 3 || score != 10 {
+		t.Fatalf("expected alice at 3 with 10, got %d %v %v", rank, score, err)
+	}
+	if rank, _, err := lb.GetRank(ctx, "nobody"); err != nil || rank != 0 {
+		t.Fatalf("expected rank 0 for a missing member, got %d %v", rank, err)
+	}
+}
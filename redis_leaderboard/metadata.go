@@ -0,0 +1,142 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Metadata is what clients display next to a member, e.g. a display name
+// and an avatar URL. It is stored as JSON in a hash next to the board's
+// sorted set, keyed by member, and shared by the board's period views.
+type Metadata map[string]string
+
+// SetMetadata replaces member's metadata. An empty map removes it.
+func (lb *Leaderboard) SetMetadata(ctx context.Context, member string, md Metadata) error {
+	if lb.readOnly {
+		return ErrReadOnly
+	}
+	if len(md) == 0 {
+		return lb.client.HDel(ctx, lb.metaKey, member).Err()
+	}
+	data, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	return lb.client.HSet(ctx, lb.metaKey, member, data).Err()
+}
+
+// GetMetadata returns member's metadata, or nil if none is stored.
+func (lb *Leaderboard) GetMetadata(ctx context.Context, member string) (Metadata, error) {
+	data, err := lb.client.HGet(ctx, lb.metaKey, member).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseMetadata(member, data)
+}
+
+func parseMetadata(member, data string) (Metadata, error) {
+	var md Metadata
+	if err := json.Unmarshal([]byte(data), &md); err != nil {
+		return nil, fmt.Errorf("corrupt metadata for %q: %w", member, err)
+	}
+	return md, nil
+}
+
+// GetRanks looks up several members at once, with their metadata, in one
+// round trip. The result has one entry per member in the given order; members
+// not on the board have rank 0.
+func (lb *Leaderboard) GetRanks(ctx context.Context, members ...string) ([]Entry, error) {
+	if len(members) == 0 {
+		return []Entry{}, nil
+	}
+	pipe := lb.client.Pipeline()
+	ranks := make([]func() (int64, error), len(members))
+	scores := make([]*redis.FloatCmd, len(members))
+	for i, m := range members {
+		ranks[i] = lb.queueRank(ctx, pipe, lb.key, m)
+		scores[i] = pipe.ZScore(ctx, lb.key, m)
+	}
+	metas := pipe.HMGet(ctx, lb.metaKey, members...)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, len(members))
+	for i, m := range members {
+		entries[i].Member = m
+		r, err := ranks[i]()
+		if err != nil {
+			return nil, err
+		}
+		if r == 0 {
+			continue
+		}
+		entries[i].Rank = r
+		entries[i].Score = lb.decode(scores[i].Val())
+		if data, ok := metas.Val()[i].(string); ok {
+			if entries[i].Metadata, err = parseMetadata(m, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// rangeMetaScript returns the ranks ARGV[1]..ARGV[2] of the board in the
+// order ARGV[3] as member, score, metadata triples (metadata may be nil).
+var rangeMetaScript = redis.NewScript(`
+local r
+if ARGV[3] == "asc" then
+	r = redis.call("ZRANGE", KEYS[1], ARGV[1], ARGV[2], "WITHSCORES")
+else
+	r = redis.call("ZREVRANGE", KEYS[1], ARGV[1], ARGV[2], "WITHSCORES")
+end
+local out = {}
+for i = 1, #r, 2 do
+	out[#out + 1] = r[i]
+	out[#out + 1] = r[i + 1]
+	out[#out + 1] = redis.call("HGET", KEYS[2], r[i])
+end
+return out`)
+
+// TopNWithMetadata is TopN with each entry's metadata, fetched in the same
+// round trip by a script that reads the range and the metadata hash together.
+func (lb *Leaderboard) TopNWithMetadata(ctx context.Context, n int64) ([]Entry, error) {
+	if n <= 0 {
+		n = 10
+	}
+	vals, err := rangeMetaScript.Run(ctx, lb.client, []string{lb.key, lb.metaKey}, 0, n-1, string(lb.Order())).Slice()
+	if err != nil {
+		return nil, err
+	}
+	zs := make([]redis.Z, 0, len(vals)/3)
+	metas := make([]any, 0, len(vals)/3)
+	for i := 0; i+2 < len(vals); i += 3 {
+		member, _ := vals[i].(string)
+		scoreStr, _ := vals[i+1].(string)
+		score, err := ParseScore(scoreStr)
+		if err != nil {
+			return nil, err
+		}
+		zs = append(zs, redis.Z{Score: score, Member: member})
+		metas = append(metas, vals[i+2])
+	}
+	entries, err := lb.rankEntries(ctx, 0, zs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if data, ok := metas[i].(string); ok {
+			if entries[i].Metadata, err = parseMetadata(entries[i].Member, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
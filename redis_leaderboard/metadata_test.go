@@ -0,0 +1,48 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetRanksWithMetadata(t *testing.T) {
+	ctx := context.Background()
+	lb := NewLeaderboard(newTestClient(t), "test:scores")
+	submitAll(t, lb, "alice", 10, "bob", 30, "carol", 20)
+	if err := lb.SetMetadata(ctx, "bob", Metadata{"name": "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := lb.GetRanks(ctx, "carol", "nobody", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected one entry per member, got %+v", entries)
+	}
+	if e := entries[0]; e.Member != "carol" || e.Rank != 2 || e.Score != 20 || e.Metadata != nil {
+		t.Fatalf("unexpected entry for carol: %+v", e)
+	}
+	if e := entries[1]; e.Member != "nobody" || e.Rank != 0 {
+		t.Fatalf("expected rank 0 for a missing member, got %+v", e)
+	}
+	if e := entries[2]; e.Member != "bob" || e.Rank != 1 || e.Metadata["name"] != "Bob" {
+		t.Fatalf("unexpected entry for bob: %+v", e)
+	}
+
+	top, err := lb.TopNWithMetadata(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].Member != "bob" || top[0].Metadata["name"] != "Bob" || top[1].Member != "carol" || top[1].Metadata != nil {
+		t.Fatalf("unexpected top 2: %+v", top)
+	}
+
+	// An empty map removes the metadata.
+	if err := lb.SetMetadata(ctx, "bob", nil); err != nil {
+		t.Fatal(err)
+	}
+	if md, err := lb.GetMetadata(ctx, "bob"); err != nil || md != nil {
+		t.Fatalf("expected no metadata after removal, got %v %v", md, err)
+	}
+}
@@ -0,0 +1,64 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Order decides which end of the board ranks first.
+type Order string
+
+const (
+	// Descending ranks the highest score first. This is the default.
+	Descending Order = "desc"
+	// Ascending ranks the lowest score first, for race times, golf and the like.
+	Ascending Order = "asc"
+)
+
+// ParseOrder parses an order name.
+func ParseOrder(s string) (Order, error) {
+	switch o := Order(s); o {
+	case Descending, Ascending:
+		return o, nil
+	case "":
+		return Descending, nil
+	}
+	return "", fmt.Errorf("unknown order %q", s)
+}
+
+// WithOrder sets which end of the board ranks first.
+func WithOrder(o Order) Option {
+	return func(lb *Leaderboard) {
+		lb.order = o
+	}
+}
+
+// Order returns the board's ranking order.
+func (lb *Leaderboard) Order() Order {
+	if lb.order == Ascending {
+		return Ascending
+	}
+	return Descending
+}
+
+func (lb *Leaderboard) ascending() bool {
+	return lb.order == Ascending
+}
+
+// zrank queues or runs the rank lookup for the board's order (0-based).
+func (lb *Leaderboard) zrank(ctx context.Context, c redis.Cmdable, key, member string) *redis.IntCmd {
+	if lb.ascending() {
+		return c.ZRank(ctx, key, member)
+	}
+	return c.ZRevRank(ctx, key, member)
+}
+
+// zrange queues or runs a range by rank (0-based, inclusive) in the board's order.
+func (lb *Leaderboard) zrange(ctx context.Context, c redis.Cmdable, key string, start, stop int64) *redis.ZSliceCmd {
+	if lb.ascending() {
+		return c.ZRangeWithScores(ctx, key, start, stop)
+	}
+	return c.ZRevRangeWithScores(ctx, key, start, stop)
+}
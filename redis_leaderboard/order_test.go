@@ -0,0 +1,52 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseOrder(t *testing.T) {
+	for s, want := range map[string]Order{"": Descending, "desc": Descending, "asc": Ascending} {
+		if got, err := ParseOrder(s); err != nil || got != want {
+			t.Fatalf("ParseOrder(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseOrder("up"); err == nil {
+		t.Fatal("expected an error for an unknown order")
+	}
+}
+
+// Test that the lowest score ranks first on an Ascending board, with ties
+// still ordered by member name.
+func TestAscendingOrder(t *testing.T) {
+	ctx := context.Background()
+	lb := NewLeaderboard(newTestClient(t), "test:scores", WithOrder(Ascending))
+	submitAll(t, lb, "carol", 30, "alice", 10, "dave", 40, "bob", 20, "bea", 20)
+
+	top, err := lb.TopN(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 3 || top[0].Member != "alice" || top[1].Member != "bea" || top[2].Member != "bob" || top[2].Rank != 3 {
+		t.Fatalf("unexpected top 3: %+v", top)
+	}
+	if rank, score, err := lb.GetRank(ctx, "dave"); err != nil || rank != 5 || score != 40 {
+		t.Fatalf("expected dave last with 40, got %d %v %v", rank, score, err)
+	}
+
+	around, err := lb.GetAround(ctx, "bob", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(around) != 3 || around[0].Member != "bea" || around[1].Member != "bob" || around[2].Member != "carol" || around[1].Rank != 3 {
+		t.Fatalf("unexpected entries around bob: %+v", around)
+	}
+
+	// Lowering a score moves the member up.
+	if _, err := lb.IncrementScore(ctx, "dave", -35); err != nil {
+		t.Fatal(err)
+	}
+	if rank, score, err := lb.GetRank(ctx, "dave"); err != nil || rank != 1 || score != 5 {
+		t.Fatalf("expected dave first with 5, got %d %v %v", rank, score, err)
+	}
+}
@@ -0,0 +1,227 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultPageLimit = 10
+
+// ErrInvalidPageToken is returned for page tokens that were not issued by a Page.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// PageQuery selects one page of a listing.
+type PageQuery struct {
+	Offset int64  // Entries to skip from the start of the listing; ignored with Token
+	Token  string // Page.Next of the previous page
+	Limit  int64  // Page size, 10 if <= 0
+}
+
+// Page is one page of a listing.
+type Page struct {
+	Entries []Entry `json:"entries"`
+	Total   int64   `json:"total"`          // Entries in the whole listing
+	Next    string  `json:"next,omitempty"` // Token for the following page; empty on the last page
+}
+
+// pageToken marks the last entry of a page. Continuing from the entry rather
+// than from its position keeps pages from repeating or skipping players when
+// others join or leave between requests.
+type pageToken struct {
+	Score  float64 `json:"s"` // Stored score
+	Member string  `json:"m"`
+}
+
+func (t pageToken) encode() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(s string) (pageToken, error) {
+	var t pageToken
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &t)
+	}
+	if err != nil || t.Member == "" {
+		return pageToken{}, ErrInvalidPageToken
+	}
+	return t, nil
+}
+
+// formatScore formats a stored score as a ZCOUNT/ZRANGEBYSCORE bound.
+func formatScore(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// List pages through the whole board, best first.
+func (lb *Leaderboard) List(ctx context.Context, q PageQuery) (Page, error) {
+	total, err := lb.TotalCount(ctx)
+	if err != nil {
+		return Page{}, err
+	}
+	return lb.page(ctx, 0, total, q)
+}
+
+// GetByScoreRange pages through the members whose score is within
+// [minScore, maxScore], best first. Ranks are board-wide, not relative to
+// the range.
+func (lb *Leaderboard) GetByScoreRange(ctx context.Context, minScore, maxScore float64, q PageQuery) (Page, error) {
+	lo, hi := lb.storedRange(minScore, maxScore)
+	if lo > hi {
+		return Page{Entries: []Entry{}}, nil
+	}
+	// The range is contiguous in rank order and starts after every member
+	// scoring better than its best end.
+	aboveMin, aboveMax := "("+formatScore(hi), "+inf"
+	if lb.ascending() {
+		aboveMin, aboveMax = "-inf", "("+formatScore(lo)
+	}
+	pipe := lb.client.Pipeline()
+	above := pipe.ZCount(ctx, lb.key, aboveMin, aboveMax)
+	count := pipe.ZCount(ctx, lb.key, formatScore(lo), formatScore(hi))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Page{}, err
+	}
+	return lb.page(ctx, above.Val(), count.Val(), q)
+}
+
+// storedRange converts player scores [minScore, maxScore] to stored scores.
+// With a time tie-break only whole scores exist, so the bounds round inwards.
+func (lb *Leaderboard) storedRange(minScore, maxScore float64) (lo, hi float64) {
+	if !lb.timeTieBreak() {
+		return minScore, maxScore
+	}
+	return math.Ceil(minScore) * tieScale, math.Floor(maxScore)*tieScale + tieScale - 1
+}
+
+// page returns one page of the listing made of the count entries starting at
+// 0-based board position first.
+func (lb *Leaderboard) page(ctx context.Context, first, count int64, q PageQuery) (Page, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	start := first + max(0, q.Offset)
+	if q.Token != "" {
+		pos, err := lb.resume(ctx, q.Token)
+		if err != nil {
+			return Page{}, err
+		}
+		start = max(first, pos)
+	}
+	end := first + count // Exclusive
+	page := Page{Entries: []Entry{}, Total: count}
+	if start >= end {
+		return page, nil
+	}
+	stop := min(start+limit, end) - 1
+	results, err := lb.zrange(ctx, lb.client, lb.key, start, stop).Result()
+	if err != nil {
+		return Page{}, err
+	}
+	if page.Entries, err = lb.rankEntries(ctx, start, results); err != nil {
+		return Page{}, err
+	}
+	if n := len(results); n > 0 && start+int64(n) < end {
+		last := results[n-1]
+		member, _ := last.Member.(string)
+		page.Next = pageToken{Score: last.Score, Member: member}.encode()
+	}
+	return page, nil
+}
+
+// resumeScript returns the 0-based board position right after the member
+// ARGV[2] with stored score ARGV[1] in order ARGV[3]. If the member has moved
+// or left, that is where it would sort now: after every better score and
+// after the members tied on ARGV[1] that Redis orders before it by name
+// (byte-wise, reversed on descending ranges). The tied band is
+// binary-searched by rank, so even a large band costs only a few lookups.
+var resumeScript = redis.NewScript(`
+local score, member, asc = ARGV[1], ARGV[2], ARGV[3] == "asc"
+local cur = redis.call("ZSCORE", KEYS[1], member)
+if cur and tonumber(cur) == tonumber(score) then
+	if asc then
+		return redis.call("ZRANK", KEYS[1], member) + 1
+	end
+	return redis.call("ZREVRANK", KEYS[1], member) + 1
+end
+-- Lua compares strings by locale, Redis by bytes.
+local function less(a, b)
+	for i = 1, math.min(#a, #b) do
+		local x, y = string.byte(a, i), string.byte(b, i)
+		if x ~= y then
+			return x < y
+		end
+	end
+	return #a < #b
+end
+local lo
+if asc then
+	lo = redis.call("ZCOUNT", KEYS[1], "-inf", "(" .. score)
+else
+	lo = redis.call("ZCOUNT", KEYS[1], "(" .. score, "+inf")
+end
+local hi = lo + redis.call("ZCOUNT", KEYS[1], score, score)
+while lo < hi do
+	local mid = math.floor((lo + hi) / 2)
+	local m
+	if asc then
+		m = redis.call("ZRANGE", KEYS[1], mid, mid)[1]
+	else
+		m = redis.call("ZREVRANGE", KEYS[1], mid, mid)[1]
+	end
+	if (asc and less(member, m)) or (not asc and less(m, member)) then
+		hi = mid
+	else
+		lo = mid + 1
+	end
+end
+return lo`)
+
+// resume returns the board position right after the entry a page token
+// marks, or where that entry would be if the member has moved or left since.
+func (lb *Leaderboard) resume(ctx context.Context, token string) (int64, error) {
+	t, err := decodePageToken(token)
+	if err != nil {
+		return 0, err
+	}
+	return resumeScript.Run(ctx, lb.client, []string{lb.key}, formatScore(t.Score), t.Member, string(lb.Order())).Int64()
+}
+
+// Standing is where a member stands on the whole board.
+type Standing struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+	Rank   int64   `json:"rank"` // 0 if the member is not on the board
+	Total  int64   `json:"total"`
+	Top    float64 `json:"top"` // Rank as a percentage of Total, e.g. 3 for "top 3%"
+}
+
+// Percentile reports member's rank relative to the size of the board. Ranks
+// follow the board's RankMode, so tied players share a percentile with
+// Competition or Dense ranking.
+func (lb *Leaderboard) Percentile(ctx context.Context, member string) (Standing, error) {
+	pipe := lb.client.Pipeline()
+	rank := lb.queueRank(ctx, pipe, lb.key, member)
+	score := pipe.ZScore(ctx, lb.key, member)
+	total := pipe.ZCard(ctx, lb.key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return Standing{}, err
+	}
+	st := Standing{Member: member, Total: total.Val()}
+	r, err := rank()
+	if err != nil || r == 0 || st.Total == 0 {
+		return st, err
+	}
+	st.Rank = r
+	st.Score = lb.decode(score.Val())
+	st.Top = 100 * float64(r) / float64(st.Total)
+	return st, nil
+}
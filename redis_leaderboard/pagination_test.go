@@ -0,0 +1,80 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestPageTokenRoundTrip(t *testing.T) {
+	for _, want := range []pageToken{
+		{Score: 1500, Member: "alice"},
+		{Score: -3.25, Member: "bob with spaces/and:colons"},
+		{Score: float64(MaxTieBreakScore)*tieScale + tieScale - 1, Member: "édith"},
+	} {
+		got, err := decodePageToken(want.encode())
+		if err != nil || got != want {
+			t.Fatalf("round trip of %+v gave %+v, %v", want, got, err)
+		}
+	}
+}
+
+func TestDecodePageTokenRejectsTampering(t *testing.T) {
+	valid := pageToken{Score: 10, Member: "alice"}.encode()
+	for name, token := range map[string]string{
+		"not base64":     "!!!",
+		"truncated":      valid[:len(valid)-3],
+		"not json":       base64.RawURLEncoding.EncodeToString([]byte("alice")),
+		"missing member": base64.RawURLEncoding.EncodeToString([]byte(`{"s":10}`)),
+		"wrong types":    base64.RawURLEncoding.EncodeToString([]byte(`{"s":"10","m":"alice"}`)),
+		"padded":         valid + "==",
+	} {
+		if _, err := decodePageToken(token); !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("%s: expected ErrInvalidPageToken, got %v", name, err)
+		}
+	}
+}
+
+// Test that paging by token neither repeats nor skips players when the last
+// player of a page leaves, including players tied with it by score.
+func TestListResumesAfterTokenMemberLeaves(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	for _, order := range []Order{Descending, Ascending} {
+		lb := NewLeaderboard(client, "test:"+string(order), WithOrder(order))
+		submitAll(t, lb, "a", 10, "b", 10, "c", 10, "d", 10, "e", 10, "top", 99, "bottom", 1)
+
+		var got []string
+		page, err := lb.List(ctx, PageQuery{Limit: 3})
+		for {
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range page.Entries {
+				got = append(got, e.Member)
+			}
+			if page.Next == "" {
+				break
+			}
+			// The last player of every page leaves before the next request.
+			if err := lb.Remove(ctx, page.Entries[len(page.Entries)-1].Member); err != nil {
+				t.Fatal(err)
+			}
+			page, err = lb.List(ctx, PageQuery{Limit: 3, Token: page.Next})
+		}
+
+		want := []string{"top", "e", "d", "c", "b", "a", "bottom"}
+		if order == Ascending {
+			want = []string{"bottom", "a", "b", "c", "d", "e", "top"}
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %v, want %v", order, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: got %v, want %v", order, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Period is a time window a leaderboard can keep a separate ranking for.
+// Periods are calendar based and computed in UTC; weeks are ISO weeks
+// starting on Monday.
+type Period string
+
+const (
+	AllTime Period = "alltime"
+	Daily   Period = "daily"
+	Weekly  Period = "weekly"
+	Monthly Period = "monthly"
+)
+
+// defaultRetention is how long a period's set is kept after the period ends.
+var defaultRetention = map[Period]time.Duration{
+	Daily:   7 * 24 * time.Hour,
+	Weekly:  5 * 7 * 24 * time.Hour,
+	Monthly: 92 * 24 * time.Hour,
+}
+
+// ParsePeriod parses a period name.
+func ParsePeriod(s string) (Period, error) {
+	switch p := Period(s); p {
+	case AllTime, Daily, Weekly, Monthly:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown period %q", s)
+}
+
+// WithPeriods makes SubmitScore and IncrementScore also write to the
+// current set of each period, alongside the all-time set.
+func WithPeriods(periods ...Period) Option {
+	return func(lb *Leaderboard) {
+		for _, p := range periods {
+			if p != AllTime && !lb.hasPeriod(p) {
+				lb.periods = append(lb.periods, p)
+			}
+		}
+	}
+}
+
+// WithRetention sets how long a finished period's set is kept before Redis
+// expires it.
+func WithRetention(p Period, keep time.Duration) Option {
+	return func(lb *Leaderboard) {
+		if lb.retention == nil {
+			lb.retention = make(map[Period]time.Duration)
+		}
+		lb.retention[p] = keep
+	}
+}
+
+// Periods returns the periods the leaderboard writes to, besides all-time.
+func (lb *Leaderboard) Periods() []Period {
+	return append([]Period(nil), lb.periods...)
+}
+
+func (lb *Leaderboard) hasPeriod(p Period) bool {
+	for _, q := range lb.periods {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (lb *Leaderboard) retentionFor(p Period) time.Duration {
+	if d, ok := lb.retention[p]; ok {
+		return d
+	}
+	return defaultRetention[p]
+}
+
+// periodKey is the key of p's set for the period containing t.
+func (lb *Leaderboard) periodKey(p Period, t time.Time) string {
+	return lb.key + ":" + string(p) + ":" + PeriodID(p, t)
+}
+
+// periodWrite is one period set a score write must touch.
+type periodWrite struct {
+	key      string
+	expireAt time.Time
+}
+
+// currentPeriods returns the sets of the periods containing now.
+func (lb *Leaderboard) currentPeriods(now time.Time) []periodWrite {
+	writes := make([]periodWrite, len(lb.periods))
+	for i, p := range lb.periods {
+		writes[i] = periodWrite{
+			key:      lb.periodKey(p, now),
+			expireAt: periodEnd(p, now).Add(lb.retentionFor(p)),
+		}
+	}
+	return writes
+}
+
+// Period returns a read-only view of the p ranking for the period containing
+// at (e.g. yesterday's daily board). It has the same query methods as the
+// all-time board; periods no longer retained are simply empty. AllTime
+// returns lb itself.
+func (lb *Leaderboard) Period(p Period, at time.Time) (*Leaderboard, error) {
+	if p == AllTime {
+		return lb, nil
+	}
+	if !lb.hasPeriod(p) {
+		return nil, fmt.Errorf("leaderboard does not track %s periods", p)
+	}
+	view := *lb
+	view.key = lb.periodKey(p, at)
+	view.periods = nil
+	view.readOnly = true
+	return &view, nil
+}
+
+// RetainedPeriods lists the IDs of p's periods still stored in Redis, oldest
+// first.
+func (lb *Leaderboard) RetainedPeriods(ctx context.Context, p Period) ([]string, error) {
+	if !lb.hasPeriod(p) {
+		return nil, fmt.Errorf("leaderboard does not track %s periods", p)
+	}
+	prefix := lb.key + ":" + string(p) + ":"
+	var ids []string
+	iter := lb.client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		id := strings.TrimPrefix(iter.Val(), prefix)
+		if !strings.Contains(id, ":") { // Skip the periods' dense indexes
+			ids = append(ids, id)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	// IDs are zero-padded, so lexical order is chronological.
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// PeriodID formats the period containing t: "2006-01-02" for days,
+// "2006-W01" for ISO weeks and "2006-01" for months.
+func PeriodID(p Period, t time.Time) string {
+	t = t.UTC()
+	switch p {
+	case Daily:
+		return t.Format("2006-01-02")
+	case Weekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case Monthly:
+		return t.Format("2006-01")
+	}
+	return ""
+}
+
+// ParsePeriodID returns the start of the period identified by id.
+func ParsePeriodID(p Period, id string) (time.Time, error) {
+	switch p {
+	case Daily:
+		return time.Parse("2006-01-02", id)
+	case Monthly:
+		return time.Parse("2006-01", id)
+	case Weekly:
+		var year, week int
+		if _, err := fmt.Sscanf(id, "%04d-W%02d", &year, &week); err != nil || week < 1 || week > 53 {
+			return time.Time{}, fmt.Errorf("invalid week %q, want e.g. 2024-W07", id)
+		}
+		// January 4th is always in ISO week 1.
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+		monday := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + 6) % 7))
+		start := monday.AddDate(0, 0, (week-1)*7)
+		if PeriodID(Weekly, start) != id {
+			return time.Time{}, fmt.Errorf("week %q does not exist", id)
+		}
+		return start, nil
+	}
+	return time.Time{}, fmt.Errorf("period %s has no IDs", p)
+}
+
+// periodStart returns the first instant of the period containing t.
+func periodStart(p Period, t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch p {
+	case Weekly:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case Monthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// periodEnd returns the first instant after the period containing t.
+func periodEnd(p Period, t time.Time) time.Time {
+	start := periodStart(p, t)
+	switch p {
+	case Weekly:
+		return start.AddDate(0, 0, 7)
+	case Monthly:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// addToPeriods queues writes of member's score to the current period sets,
+// refreshing their expiry and that of their dense index.
+func (lb *Leaderboard) addToPeriods(ctx context.Context, pipe redis.Pipeliner, write func(key string)) {
+	for _, pw := range lb.currentPeriods(time.Now()) {
+		write(pw.key)
+		for _, key := range denseKeys(pw.key) {
+			pipe.ExpireAt(ctx, key, pw.expireAt)
+		}
+	}
+}
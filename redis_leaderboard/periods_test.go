@@ -0,0 +1,74 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPeriodIDRoundTrip(t *testing.T) {
+	for _, c := range []struct {
+		p    Period
+		at   time.Time
+		id   string
+		from time.Time
+	}{
+		{Daily, time.Date(2024, 2, 29, 23, 59, 0, 0, time.UTC), "2024-02-29", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{Monthly, time.Date(2024, 12, 31, 12, 0, 0, 0, time.UTC), "2024-12", time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)},
+		// ISO weeks can belong to the neighbouring year.
+		{Weekly, time.Date(2024, 12, 30, 8, 0, 0, 0, time.UTC), "2025-W01", time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC)},
+		{Weekly, time.Date(2021, 1, 3, 8, 0, 0, 0, time.UTC), "2020-W53", time.Date(2020, 12, 28, 0, 0, 0, 0, time.UTC)},
+		// Non-UTC times are converted first.
+		{Daily, time.Date(2024, 3, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600)), "2024-03-01", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		id := PeriodID(c.p, c.at)
+		if id != c.id {
+			t.Fatalf("PeriodID(%s, %v) = %q, want %q", c.p, c.at, id, c.id)
+		}
+		start, err := ParsePeriodID(c.p, id)
+		if err != nil || !start.Equal(c.from) || !start.Equal(periodStart(c.p, c.at)) {
+			t.Fatalf("ParsePeriodID(%s, %q) = %v, %v; want %v", c.p, id, start, err, c.from)
+		}
+		if PeriodID(c.p, start) != id || PeriodID(c.p, periodEnd(c.p, c.at)) == id {
+			t.Fatalf("%s %q: start or end fall in the wrong period", c.p, id)
+		}
+	}
+
+	for _, bad := range []string{"2024-W00", "2024-W54", "2021-W53", "2024-7", "W01"} {
+		if _, err := ParsePeriodID(Weekly, bad); err == nil {
+			t.Errorf("expected ParsePeriodID(weekly, %q) to fail", bad)
+		}
+	}
+}
+
+// Test that submissions land in the current period sets, which expire after
+// the retention, and that period views are read-only.
+func TestPeriodRankings(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	lb := NewLeaderboard(client, "test:scores", WithPeriods(Daily, Weekly), WithRetention(Daily, time.Hour))
+	submitAll(t, lb, "alice", 10, "bob", 20)
+
+	now := time.Now()
+	today, err := lb.Period(Daily, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := today.TopN(ctx, 10)
+	if err != nil || len(top) != 2 || top[0].Member != "bob" {
+		t.Fatalf("unexpected daily standings %+v, %v", top, err)
+	}
+	if _, err := today.SubmitScore(ctx, "carol", 1); err != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if ttl := client.TTL(ctx, today.key).Val(); ttl <= 0 || ttl > time.Until(periodEnd(Daily, now))+time.Hour {
+		t.Fatalf("unexpected daily TTL %v", ttl)
+	}
+	if _, err := lb.Period(Monthly, now); err == nil {
+		t.Fatalf("expected an untracked period to be refused")
+	}
+	ids, err := lb.RetainedPeriods(ctx, Weekly)
+	if err != nil || len(ids) != 1 || ids[0] != PeriodID(Weekly, now) {
+		t.Fatalf("expected this week to be retained, got %v, %v", ids, err)
+	}
+}
@@ -0,0 +1,240 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RankMode decides how ranks are numbered when players share a score.
+type RankMode string
+
+const (
+	// Ordinal gives every player a distinct rank (1, 2, 3, 4), ties ordered by
+	// the board's TieBreak. This is the default.
+	Ordinal RankMode = "ordinal"
+	// Competition gives tied players the same rank and skips the ranks they
+	// use up (1, 2, 2, 4).
+	Competition RankMode = "competition"
+	// Dense gives tied players the same rank without gaps (1, 2, 2, 3).
+	Dense RankMode = "dense"
+)
+
+// ParseRankMode parses a rank mode name.
+func ParseRankMode(s string) (RankMode, error) {
+	switch m := RankMode(s); m {
+	case Ordinal, Competition, Dense:
+		return m, nil
+	case "":
+		return Ordinal, nil
+	}
+	return "", fmt.Errorf("unknown rank mode %q", s)
+}
+
+// WithRankMode sets how ranks are numbered for tied scores.
+func WithRankMode(m RankMode) Option {
+	return func(lb *Leaderboard) {
+		lb.rankMode = m
+	}
+}
+
+// RankedBy returns a view of the board that numbers ranks with m. It shares
+// the board's keys and can be written to.
+func (lb *Leaderboard) RankedBy(m RankMode) *Leaderboard {
+	view := *lb
+	view.rankMode = m
+	return &view
+}
+
+func (lb *Leaderboard) sharedRanks() bool {
+	return lb.rankMode == Competition || lb.rankMode == Dense
+}
+
+// Dense ranks are looked up in an index kept next to each sorted set: a
+// sorted set of the distinct score bands on it (<key>:dense) and a hash
+// counting the members in each band (<key>:dense:refs). A band is a score
+// without its tie-break time, so tied players share one. Every write updates
+// the index in the same script as the set, so a dense rank is one ZCOUNT of
+// the bands above the player's at any size.
+//
+// denseLib is prepended to the scripts that touch a set; they take the set
+// and its index as KEYS[1], KEYS[2] and KEYS[3]. Sets without an index, such
+// as ones restored, imported or written before the index existed, get one
+// built by denseEnsure before their first change.
+const denseLib = `
+local function band(s, scale)
+	if scale <= 1 then
+		return s
+	end
+	return string.format("%.0f", math.floor(tonumber(s) / scale) * scale)
+end
+local function denseAdd(s, scale)
+	local b = band(s, scale)
+	if redis.call("HINCRBY", KEYS[3], b, 1) == 1 then
+		redis.call("ZADD", KEYS[2], b, b)
+	end
+end
+local function denseRem(s, scale)
+	local b = band(s, scale)
+	if redis.call("HINCRBY", KEYS[3], b, -1) <= 0 then
+		redis.call("HDEL", KEYS[3], b)
+		redis.call("ZREM", KEYS[2], b)
+	end
+end
+-- denseMove moves a member from stored score old to new; either may be
+-- false for a member joining or leaving the set.
+local function denseMove(old, new, scale)
+	if old and new and band(old, scale) == band(new, scale) then
+		return
+	end
+	if old then
+		denseRem(old, scale)
+	end
+	if new then
+		denseAdd(new, scale)
+	end
+end
+local function denseEnsure(scale)
+	if redis.call("EXISTS", KEYS[3]) == 1 then
+		return
+	end
+	local n = redis.call("ZCARD", KEYS[1])
+	if n == 0 then
+		return
+	end
+	redis.call("DEL", KEYS[2])
+	for i = 0, n - 1, 1000 do
+		local r = redis.call("ZRANGE", KEYS[1], i, i + 999, "WITHSCORES")
+		for j = 2, #r, 2 do
+			denseAdd(r[j], scale)
+		end
+	end
+	local ttl = redis.call("PTTL", KEYS[1])
+	if ttl > 0 then
+		redis.call("PEXPIRE", KEYS[2], ttl)
+		redis.call("PEXPIRE", KEYS[3], ttl)
+	end
+end
+`
+
+// denseKeys returns key followed by the keys of its dense index.
+func denseKeys(key string) []string {
+	return []string{key, key + ":dense", key + ":dense:refs"}
+}
+
+// bandScale is the factor a stored score is divided by to find its band.
+func (lb *Leaderboard) bandScale() int {
+	if lb.timeTieBreak() {
+		return tieScale
+	}
+	return 1
+}
+
+// rankScript returns the Competition or Dense rank of ARGV[1], or nil if it
+// is not on the board. Tied players are those whose stored scores fall in the
+// same band of ARGV[4] (the tie-break scale, 1 without a time tie-break).
+// A competition rank is one ZCOUNT of the set; a dense rank is one ZCOUNT of
+// its index.
+var rankScript = redis.NewScript(denseLib + `
+local cur = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not cur then
+	return false
+end
+local asc, scale = ARGV[3] == "asc", tonumber(ARGV[4])
+local key, lo, hi = KEYS[1], band(cur, scale), cur
+if scale > 1 then
+	hi = string.format("%.0f", tonumber(lo) + scale - 1)
+end
+if ARGV[2] == "dense" then
+	denseEnsure(scale)
+	key, hi = KEYS[2], lo
+end
+-- Count the scores, or for a dense rank the bands, ranked above the player's.
+if asc then
+	return redis.call("ZCOUNT", key, "-inf", "(" .. lo) + 1
+end
+return redis.call("ZCOUNT", key, "(" .. hi, "+inf") + 1`)
+
+// removeScript removes ARGV[1] from the set, with the tie-break scale
+// ARGV[2], and returns the number of members removed.
+var removeScript = redis.NewScript(denseLib + `
+local scale = tonumber(ARGV[2])
+denseEnsure(scale)
+local cur = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not cur then
+	return 0
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+denseMove(cur, false, scale)
+return 1`)
+
+// queueRank queues a lookup of member's 1-based rank in key and returns a
+// function reporting it once the pipeline has run (0 if absent).
+func (lb *Leaderboard) queueRank(ctx context.Context, pipe redis.Pipeliner, key, member string) func() (int64, error) {
+	var result func() (int64, error)
+	if lb.sharedRanks() {
+		cmd := rankScript.Eval(ctx, pipe, denseKeys(key), member, string(lb.rankMode), string(lb.Order()), lb.bandScale())
+		result = cmd.Int64
+	} else {
+		cmd := lb.zrank(ctx, pipe, key, member)
+		result = func() (int64, error) {
+			r, err := cmd.Result()
+			return r + 1, err // ZRank/ZRevRank are 0-based
+		}
+	}
+	return func() (int64, error) {
+		r, err := result()
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return r, err
+	}
+}
+
+// rankEntries converts a range of the board starting at 0-based position
+// start into entries numbered by the board's RankMode. Only the first entry's
+// rank needs a lookup; the rest follow from the scores in the range.
+func (lb *Leaderboard) rankEntries(ctx context.Context, start int64, zs []redis.Z) ([]Entry, error) {
+	entries := make([]Entry, len(zs))
+	for i, z := range zs {
+		member, _ := z.Member.(string)
+		entries[i] = Entry{Member: member, Score: lb.decode(z.Score), Rank: start + int64(i) + 1}
+	}
+	if !lb.sharedRanks() || len(entries) == 0 {
+		return entries, nil
+	}
+	if start > 0 {
+		pipe := lb.client.Pipeline()
+		rank := lb.queueRank(ctx, pipe, lb.key, entries[0].Member)
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		r, err := rank()
+		if err != nil {
+			return nil, err
+		}
+		if r > 0 {
+			entries[0].Rank = r
+		}
+	}
+	lb.shareTiedRanks(entries)
+	return entries, nil
+}
+
+// shareTiedRanks renumbers consecutive entries after the first one according
+// to the board's RankMode. Entries must hold ordinal ranks on input.
+func (lb *Leaderboard) shareTiedRanks(entries []Entry) {
+	if !lb.sharedRanks() {
+		return
+	}
+	for i := 1; i < len(entries); i++ {
+		prev := entries[i-1]
+		switch {
+		case entries[i].Score == prev.Score:
+			entries[i].Rank = prev.Rank
+		case lb.rankMode == Dense:
+			entries[i].Rank = prev.Rank + 1
+		}
+	}
+}
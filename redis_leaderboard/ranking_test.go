@@ -0,0 +1,199 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestShareTiedRanks(t *testing.T) {
+	scores := []float64{50, 40, 40, 30, 30, 30, 20}
+	for mode, want := range map[RankMode][]int64{
+		Ordinal:     {1, 2, 3, 4, 5, 6, 7},
+		Competition: {1, 2, 2, 4, 4, 4, 7},
+		Dense:       {1, 2, 2, 3, 3, 3, 4},
+	} {
+		lb := NewLeaderboard(nil, "", WithRankMode(mode))
+		entries := make([]Entry, len(scores))
+		for i, s := range scores {
+			entries[i] = Entry{Score: s, Rank: int64(i) + 1}
+		}
+		lb.shareTiedRanks(entries)
+		for i, e := range entries {
+			if e.Rank != want[i] {
+				t.Fatalf("%s: ranks %v, want %v", mode, ranksOf(entries), want)
+			}
+		}
+	}
+
+	// A page starting mid-board keeps numbering from its first entry.
+	lb := NewLeaderboard(nil, "", WithRankMode(Dense))
+	entries := []Entry{{Score: 30, Rank: 3}, {Score: 30, Rank: 5}, {Score: 20, Rank: 6}}
+	lb.shareTiedRanks(entries)
+	if got := ranksOf(entries); got[1] != 3 || got[2] != 4 {
+		t.Fatalf("expected [3 3 4], got %v", got)
+	}
+}
+
+func ranksOf(entries []Entry) []int64 {
+	ranks := make([]int64, len(entries))
+	for i, e := range entries {
+		ranks[i] = e.Rank
+	}
+	return ranks
+}
+
+// Test that the rank script numbers ties like shareTiedRanks, in both orders
+// and with a time tie-break packing several stored scores into one band.
+func TestRankLookupsShareTies(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	for _, c := range []struct {
+		order Order
+		tie   TieBreak
+		want  map[RankMode][]int64 // Ranks of a..e
+	}{
+		{Descending, Lexicographic, map[RankMode][]int64{
+			Competition: {1, 2, 2, 4, 5}, Dense: {1, 2, 2, 3, 4},
+		}},
+		{Ascending, EarliestFirst, map[RankMode][]int64{
+			Competition: {5, 3, 3, 2, 1}, Dense: {4, 3, 3, 2, 1},
+		}},
+	} {
+		key := fmt.Sprintf("test:%s:%s", c.order, c.tie)
+		lb := NewLeaderboard(client, key, WithOrder(c.order), WithTieBreak(c.tie))
+		submitAll(t, lb, "a", 50, "b", 40, "c", 40, "d", 30, "e", 20)
+		for mode, want := range c.want {
+			entries, err := lb.RankedBy(mode).GetRanks(ctx, "a", "b", "c", "d", "e")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ranksOf(entries); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("%s/%s %s: ranks %v, want %v", c.order, c.tie, mode, got, want)
+			}
+		}
+	}
+}
+
+// checkDenseRanks compares the dense rank of every member, looked up in the
+// board's index, with the ranks numbered from the board's full standings.
+func checkDenseRanks(t *testing.T, lb *Leaderboard) {
+	t.Helper()
+	ctx := context.Background()
+	dense := lb.RankedBy(Dense)
+	want, err := dense.TopN(ctx, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := make([]string, len(want))
+	for i, e := range want {
+		members[i] = e.Member
+	}
+	got, err := dense.GetRanks(ctx, members...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		if got[i].Rank != want[i].Rank {
+			t.Fatalf("%s: dense rank %d, want %d", want[i].Member, got[i].Rank, want[i].Rank)
+		}
+	}
+	var bands int64
+	if len(want) > 0 {
+		bands = want[len(want)-1].Rank
+	}
+	if n, err := lb.client.ZCard(ctx, denseKeys(lb.key)[1]).Result(); err != nil || n != bands {
+		t.Fatalf("expected %d bands in the index, got %d, %v", bands, n, err)
+	}
+}
+
+// Test that dense ranks stay correct on a board of any size through every
+// write path, starting from a set written before it had an index.
+func TestDenseIndex(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	lb := NewLeaderboard(client, "test:scores", WithRankMode(Dense), WithPeriods(Daily))
+
+	zs := make([]redis.Z, 1500)
+	for i := range zs {
+		zs[i] = redis.Z{Score: float64(i % 300), Member: fmt.Sprintf("m%d", i)}
+	}
+	client.ZAdd(ctx, lb.key, zs...)
+	checkDenseRanks(t, lb)
+
+	if _, err := lb.SubmitScore(ctx, "newcomer", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if rank, _, err := lb.GetRank(ctx, "newcomer"); err != nil || rank != 1 {
+		t.Fatalf("expected newcomer to rank 1, got %d, %v", rank, err)
+	}
+	if _, err := lb.SubmitScore(ctx, "m0", 150.5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lb.IncrementScore(ctx, "m1", 0.25); err != nil {
+		t.Fatal(err)
+	}
+	if err := lb.Remove(ctx, "newcomer"); err != nil {
+		t.Fatal(err)
+	}
+	checkDenseRanks(t, lb)
+
+	today, err := lb.Period(Daily, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDenseRanks(t, today)
+	if ids, err := lb.RetainedPeriods(ctx, Daily); err != nil || len(ids) != 1 {
+		t.Fatalf("expected the index not to be listed as a period, got %v, %v", ids, err)
+	}
+	if ttl, err := client.TTL(ctx, denseKeys(today.key)[2]).Result(); err != nil || ttl <= 0 {
+		t.Fatalf("expected the period's index to expire with it, got %v, %v", ttl, err)
+	}
+
+	snap, err := lb.Snapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	submitAll(t, lb, "m2", 5000)
+	if err := lb.Restore(ctx, snap, ""); err != nil {
+		t.Fatal(err)
+	}
+	checkDenseRanks(t, lb)
+
+	archived, err := lb.Rollover(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDenseRanks(t, archived)
+	if seasons, err := lb.Seasons(ctx); err != nil || len(seasons) != 1 {
+		t.Fatalf("expected the index not to be listed as a season, got %v, %v", seasons, err)
+	}
+	if n, _ := client.Exists(ctx, denseKeys(lb.key)...).Result(); n != 0 {
+		t.Fatalf("expected the live board and its index to be empty after Rollover, got %d keys", n)
+	}
+	submitAll(t, lb, "a", 2, "b", 1)
+	checkDenseRanks(t, lb)
+}
+
+// Test that the index groups stored scores by band with a time tie-break,
+// so resubmitting and incrementing keep tied players in one band.
+func TestDenseIndexTieBreak(t *testing.T) {
+	ctx := context.Background()
+	lb := NewLeaderboard(newTestClient(t), "test:scores", WithRankMode(Dense), WithTieBreak(EarliestFirst))
+	submitAll(t, lb, "a", 50, "b", 40, "c", 40, "d", 30)
+	if _, err := lb.IncrementScore(ctx, "d", 10); err != nil {
+		t.Fatal(err)
+	}
+	checkDenseRanks(t, lb)
+	if rank, _, err := lb.GetRank(ctx, "d"); err != nil || rank != 2 {
+		t.Fatalf("expected d to tie at 2, got %d, %v", rank, err)
+	}
+	if _, err := lb.IncrementScore(ctx, "d", -40); err != nil {
+		t.Fatal(err)
+	}
+	submitAll(t, lb, "b", 40)
+	checkDenseRanks(t, lb)
+}
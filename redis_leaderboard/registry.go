@@ -0,0 +1,284 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultRegistryPrefix = "leaderboard"
+
+var (
+	// ErrBoardNotFound is returned for names that were never created (or were deleted).
+	ErrBoardNotFound = errors.New("leaderboard not found")
+	// ErrBoardExists is returned by Create when the name is taken.
+	ErrBoardExists = errors.New("leaderboard already exists")
+	// ErrInvalidBoardName is returned for names that could not be used in a key.
+	ErrInvalidBoardName = errors.New("invalid leaderboard name")
+)
+
+// Board names become part of Redis keys, so they are restricted to characters
+// that cannot collide with the key separator or glob patterns.
+var boardNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// BoardSettings are the options a board is created with. They are stored in
+// the registry so every server instance opens the board the same way.
+type BoardSettings struct {
+	Periods  []Period   `json:"periods,omitempty"`  // Time windows ranked besides all-time
+	Order    Order      `json:"order,omitempty"`    // Defaults to Descending
+	TieBreak TieBreak   `json:"tieBreak,omitempty"` // Defaults to Lexicographic
+	Submit   SubmitMode `json:"submit,omitempty"`   // Defaults to KeepLatest
+	Ranking  RankMode   `json:"ranking,omitempty"`  // Defaults to Ordinal
+}
+
+// options converts the settings to Leaderboard options.
+func (s BoardSettings) options() []Option {
+	var opts []Option
+	if len(s.Periods) > 0 {
+		opts = append(opts, WithPeriods(s.Periods...))
+	}
+	if s.Order != "" {
+		opts = append(opts, WithOrder(s.Order))
+	}
+	if s.TieBreak != "" {
+		opts = append(opts, WithTieBreak(s.TieBreak))
+	}
+	if s.Submit != "" {
+		opts = append(opts, WithSubmitMode(s.Submit))
+	}
+	if s.Ranking != "" {
+		opts = append(opts, WithRankMode(s.Ranking))
+	}
+	return opts
+}
+
+// BoardInfo is what the registry stores about a board.
+type BoardInfo struct {
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"createdAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"` // Set while Delete removes the board's keys
+	BoardSettings
+}
+
+// Registry manages named leaderboards (per game, per region, ...). Each board
+// gets its own key namespace, <prefix>:{<name>}:*, and the set of boards is
+// kept in a Redis hash so every server instance sees the same list.
+//
+// The name is wrapped in a hash tag so all of a board's keys land in the same
+// Redis Cluster slot, which multi-key commands on one board rely on.
+type Registry struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRegistry creates a registry whose keys start with prefix
+// ("leaderboard" if empty).
+func NewRegistry(client *redis.Client, prefix string) *Registry {
+	if prefix == "" {
+		prefix = defaultRegistryPrefix
+	}
+	return &Registry{client: client, prefix: prefix}
+}
+
+// indexKey is the hash of board name → BoardInfo JSON.
+func (r *Registry) indexKey() string {
+	return r.prefix + ":boards"
+}
+
+// namespace is the key prefix shared by every key of a board.
+func (r *Registry) namespace(name string) string {
+	return r.prefix + ":{" + name + "}"
+}
+
+func validateBoardName(name string) error {
+	if !boardNameRe.MatchString(name) {
+		return fmt.Errorf("%w %q: use 1-64 letters, digits, '-' or '_'", ErrInvalidBoardName, name)
+	}
+	return nil
+}
+
+// Create registers a new board. Settings cannot be changed afterwards.
+func (r *Registry) Create(ctx context.Context, name string, settings BoardSettings) (*Leaderboard, error) {
+	if err := validateBoardName(name); err != nil {
+		return nil, err
+	}
+	for _, p := range settings.Periods {
+		if _, err := ParsePeriod(string(p)); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := ParseOrder(string(settings.Order)); err != nil {
+		return nil, err
+	}
+	if _, err := ParseTieBreak(string(settings.TieBreak)); err != nil {
+		return nil, err
+	}
+	if _, err := ParseSubmitMode(string(settings.Submit)); err != nil {
+		return nil, err
+	}
+	if _, err := ParseRankMode(string(settings.Ranking)); err != nil {
+		return nil, err
+	}
+	info := BoardInfo{Name: name, CreatedAt: time.Now().UTC(), BoardSettings: settings}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	created, err := r.client.HSetNX(ctx, r.indexKey(), name, data).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		if old, err := r.load(ctx, name); err == nil && old.DeletedAt != nil {
+			return nil, fmt.Errorf("%w: %q is being deleted", ErrBoardExists, name)
+		}
+		return nil, fmt.Errorf("%w: %q", ErrBoardExists, name)
+	}
+	return r.open(info), nil
+}
+
+// ImportKey moves an existing sorted set, such as the "leaderboard:scores"
+// key used before boards had names, into board name so its scores are kept.
+// It reports whether the key was moved: nothing is moved if key does not
+// exist, and it is an error if the board already has scores of its own.
+func (r *Registry) ImportKey(ctx context.Context, key, name string) (bool, error) {
+	if err := validateBoardName(name); err != nil {
+		return false, err
+	}
+	n, err := r.client.Exists(ctx, key).Result()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	moved, err := r.client.RenameNX(ctx, key, r.scoresKey(name)).Result()
+	if err == nil && !moved {
+		err = fmt.Errorf("board %q already has scores; %s left in place", name, key)
+	}
+	return moved, err
+}
+
+// Board returns the board registered under name.
+func (r *Registry) Board(ctx context.Context, name string) (*Leaderboard, error) {
+	info, err := r.Info(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return r.open(info), nil
+}
+
+// Info returns what the registry stores about name.
+func (r *Registry) Info(ctx context.Context, name string) (BoardInfo, error) {
+	info, err := r.load(ctx, name)
+	if err != nil {
+		return BoardInfo{}, err
+	}
+	if info.DeletedAt != nil {
+		return BoardInfo{}, fmt.Errorf("%w: %q", ErrBoardNotFound, name)
+	}
+	return info, nil
+}
+
+// load returns the registry entry for name, including deleted boards whose
+// keys are still being removed.
+func (r *Registry) load(ctx context.Context, name string) (BoardInfo, error) {
+	if err := validateBoardName(name); err != nil {
+		return BoardInfo{}, err
+	}
+	data, err := r.client.HGet(ctx, r.indexKey(), name).Bytes()
+	if err == redis.Nil {
+		return BoardInfo{}, fmt.Errorf("%w: %q", ErrBoardNotFound, name)
+	}
+	if err != nil {
+		return BoardInfo{}, err
+	}
+	var info BoardInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return BoardInfo{}, fmt.Errorf("corrupt registry entry for %q: %w", name, err)
+	}
+	return info, nil
+}
+
+func (r *Registry) scoresKey(name string) string {
+	return r.namespace(name) + ":scores"
+}
+
+func (r *Registry) open(info BoardInfo) *Leaderboard {
+	opts := append(info.options(), func(lb *Leaderboard) {
+		lb.groupKey = r.namespace(info.Name) + ":group:"
+	})
+	return NewLeaderboard(r.client, r.scoresKey(info.Name), opts...)
+}
+
+// List returns every registered board, sorted by name.
+func (r *Registry) List(ctx context.Context) ([]BoardInfo, error) {
+	raw, err := r.client.HGetAll(ctx, r.indexKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	boards := make([]BoardInfo, 0, len(raw))
+	for name, data := range raw {
+		var info BoardInfo
+		if err := json.Unmarshal([]byte(data), &info); err != nil {
+			return nil, fmt.Errorf("corrupt registry entry for %q: %w", name, err)
+		}
+		if info.DeletedAt == nil {
+			boards = append(boards, info)
+		}
+	}
+	sort.Slice(boards, func(i, j int) bool { return boards[i].Name < boards[j].Name })
+	return boards, nil
+}
+
+// Delete unregisters a board and removes all of its keys. The board is
+// first marked deleted, so lookups fail and no new writer opens it while
+// its keys are swept, and is only removed from the registry once the sweep
+// is done; until then its name cannot be reused. A Delete that failed
+// half-way can be retried.
+func (r *Registry) Delete(ctx context.Context, name string) error {
+	info, err := r.load(ctx, name)
+	if err != nil {
+		return err
+	}
+	if info.DeletedAt == nil {
+		now := time.Now().UTC()
+		info.DeletedAt = &now
+		data, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		if err := r.client.HSet(ctx, r.indexKey(), name, data).Err(); err != nil {
+			return err
+		}
+	}
+	if err := r.sweep(ctx, name); err != nil {
+		return err
+	}
+	return r.client.HDel(ctx, r.indexKey(), name).Err()
+}
+
+// sweep removes every key in the board's namespace.
+func (r *Registry) sweep(ctx context.Context, name string) error {
+	iter := r.client.Scan(ctx, 0, r.namespace(name)+":*", 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+		if len(keys) == 100 {
+			if err := r.client.Unlink(ctx, keys...).Err(); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		return r.client.Unlink(ctx, keys...).Err()
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRegistryLifecycle(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	reg := NewRegistry(client, "")
+
+	if _, err := reg.Create(ctx, "bad name", BoardSettings{}); !errors.Is(err, ErrInvalidBoardName) {
+		t.Fatalf("expected ErrInvalidBoardName, got %v", err)
+	}
+	lb, err := reg.Create(ctx, "eu", BoardSettings{Order: Ascending})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Create(ctx, "eu", BoardSettings{}); !errors.Is(err, ErrBoardExists) {
+		t.Fatalf("expected ErrBoardExists, got %v", err)
+	}
+	if _, err := reg.Create(ctx, "us", BoardSettings{}); err != nil {
+		t.Fatal(err)
+	}
+	submitAll(t, lb, "alice", 10, "bob", 5)
+
+	// A board opened later uses the stored settings.
+	again, err := reg.Board(ctx, "eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top, err := again.TopN(ctx, 1); err != nil || len(top) != 1 || top[0].Member != "bob" {
+		t.Fatalf("expected bob first on an ascending board, got %+v %v", top, err)
+	}
+
+	boards, err := reg.List(ctx)
+	if err != nil || len(boards) != 2 || boards[0].Name != "eu" || boards[1].Name != "us" {
+		t.Fatalf("unexpected boards %+v %v", boards, err)
+	}
+
+	if err := reg.Delete(ctx, "eu"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Board(ctx, "eu"); !errors.Is(err, ErrBoardNotFound) {
+		t.Fatalf("expected ErrBoardNotFound after Delete, got %v", err)
+	}
+	if n, err := client.Exists(ctx, reg.scoresKey("eu")).Result(); err != nil || n != 0 {
+		t.Fatalf("expected the board's keys to be removed, got %d %v", n, err)
+	}
+	if boards, err := reg.List(ctx); err != nil || len(boards) != 1 || boards[0].Name != "us" {
+		t.Fatalf("unexpected boards after Delete %+v %v", boards, err)
+	}
+	if _, err := reg.Create(ctx, "eu", BoardSettings{}); err != nil {
+		t.Fatalf("expected the name to be reusable after Delete, got %v", err)
+	}
+}
+
+// Test that a board left marked deleted by an interrupted Delete cannot be
+// opened or recreated, and that retrying the Delete finishes it.
+func TestRegistryDeleteRetry(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	reg := NewRegistry(client, "")
+	lb, err := reg.Create(ctx, "eu", BoardSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	submitAll(t, lb, "alice", 10)
+
+	// Mark the board deleted the way Delete does, without sweeping.
+	info, err := reg.load(ctx, "eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.DeletedAt = &info.CreatedAt
+	data, _ := json.Marshal(info)
+	if err := client.HSet(ctx, reg.indexKey(), "eu", data).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reg.Board(ctx, "eu"); !errors.Is(err, ErrBoardNotFound) {
+		t.Fatalf("expected ErrBoardNotFound while deleting, got %v", err)
+	}
+	if _, err := reg.Create(ctx, "eu", BoardSettings{}); !errors.Is(err, ErrBoardExists) {
+		t.Fatalf("expected ErrBoardExists while deleting, got %v", err)
+	}
+	if err := reg.Delete(ctx, "eu"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := client.Exists(ctx, reg.scoresKey("eu")).Result(); n != 0 {
+		t.Fatal("expected the retried Delete to remove the board's keys")
+	}
+	if _, err := reg.Create(ctx, "eu", BoardSettings{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistryImportKey(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	reg := NewRegistry(client, "")
+
+	if moved, err := reg.ImportKey(ctx, "leaderboard:scores", "main"); err != nil || moved {
+		t.Fatalf("expected nothing to import, got %v %v", moved, err)
+	}
+	client.ZAdd(ctx, "leaderboard:scores", redis.Z{Member: "alice", Score: 10})
+	if moved, err := reg.ImportKey(ctx, "leaderboard:scores", "main"); err != nil || !moved {
+		t.Fatalf("expected the key to be imported, got %v %v", moved, err)
+	}
+	if n, _ := client.ZCard(ctx, reg.scoresKey("main")).Result(); n != 1 {
+		t.Fatalf("expected 1 imported score, got %d", n)
+	}
+
+	// A second legacy key is left in place rather than overwriting the board.
+	client.ZAdd(ctx, "leaderboard:scores", redis.Z{Member: "bob", Score: 20})
+	if moved, err := reg.ImportKey(ctx, "leaderboard:scores", "main"); err == nil || moved {
+		t.Fatalf("expected an error importing into a board with scores, got %v %v", moved, err)
+	}
+	if n, _ := client.Exists(ctx, "leaderboard:scores").Result(); n != 1 {
+		t.Fatal("expected the legacy key to be left in place")
+	}
+}
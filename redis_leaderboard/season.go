@@ -0,0 +1,120 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrSeasonExists is returned by Rollover when the season was archived before.
+	ErrSeasonExists = errors.New("season already archived")
+	// ErrInvalidSeason is returned for season IDs that could not be used in a key.
+	ErrInvalidSeason = errors.New("invalid season")
+	// ErrEmptyBoard is returned by Rollover when the board has no scores to archive.
+	ErrEmptyBoard = errors.New("board is empty")
+)
+
+func validateSeason(season string) error {
+	if !boardNameRe.MatchString(season) {
+		return fmt.Errorf("%w %q: use 1-64 letters, digits, '-' or '_'", ErrInvalidSeason, season)
+	}
+	return nil
+}
+
+// seasonKey is the key the board's standings are archived under at the end
+// of season.
+func (lb *Leaderboard) seasonKey(season string) string {
+	return lb.key + ":season:" + season
+}
+
+// rolloverScript renames KEYS[1] to KEYS[2] unless KEYS[2] exists, moves
+// the dense index KEYS[5], KEYS[6] along to KEYS[7], KEYS[8], and copies the
+// metadata hash KEYS[3] to KEYS[4]. It returns -1 if KEYS[2] exists, 0 if
+// there was nothing to archive and 1 otherwise.
+var rolloverScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	return -1
+end
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("RENAME", KEYS[1], KEYS[2])
+redis.call("DEL", KEYS[4], KEYS[7], KEYS[8])
+for i = 5, 6 do
+	if redis.call("EXISTS", KEYS[i]) == 1 then
+		redis.call("RENAME", KEYS[i], KEYS[i + 2])
+	end
+end
+if redis.call("EXISTS", KEYS[3]) == 1 then
+	redis.call("COPY", KEYS[3], KEYS[4])
+end
+return 1`)
+
+// Rollover ends the current season: the board's standings move to an archive
+// key for season and the board starts over empty, in one atomic step, so no
+// score lands between the two. It returns a read-only view of the archived
+// season, e.g. to take a Snapshot. The metadata is copied into the archive as
+// it stood at the end of the season and also kept for the next one; the
+// period rankings carry on until they expire. An empty board cannot be
+// rolled over.
+func (lb *Leaderboard) Rollover(ctx context.Context, season string) (*Leaderboard, error) {
+	if lb.readOnly {
+		return nil, ErrReadOnly
+	}
+	if err := validateSeason(season); err != nil {
+		return nil, err
+	}
+	archive := lb.seasonKey(season)
+	keys := []string{lb.key, archive, lb.metaKey, archive + ":meta"}
+	keys = append(keys, denseKeys(lb.key)[1:]...)
+	keys = append(keys, denseKeys(archive)[1:]...)
+	res, err := rolloverScript.Run(ctx, lb.client, keys).Int()
+	if err != nil {
+		return nil, err
+	}
+	switch res {
+	case -1:
+		return nil, fmt.Errorf("%w: %q", ErrSeasonExists, season)
+	case 0:
+		return nil, fmt.Errorf("%w: nothing to archive as season %q", ErrEmptyBoard, season)
+	}
+	return lb.Season(season)
+}
+
+// Season returns a read-only view of an archived season, with the metadata
+// archived alongside it. Seasons that were never archived are simply empty.
+func (lb *Leaderboard) Season(season string) (*Leaderboard, error) {
+	if err := validateSeason(season); err != nil {
+		return nil, err
+	}
+	view := *lb
+	view.key = lb.seasonKey(season)
+	view.metaKey = view.key + ":meta"
+	view.season = season
+	view.periods = nil
+	view.readOnly = true
+	return &view, nil
+}
+
+// Seasons lists the archived seasons of the board, sorted by ID.
+func (lb *Leaderboard) Seasons(ctx context.Context) ([]string, error) {
+	prefix := lb.key + ":season:"
+	seasons := []string{}
+	iter := lb.client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		season := strings.TrimPrefix(iter.Val(), prefix)
+		if validateSeason(season) == nil { // Skip keys derived from an archive
+			seasons = append(seasons, season)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(seasons)
+	return seasons, nil
+}
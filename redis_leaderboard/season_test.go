@@ -0,0 +1,59 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRollover(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	lb := NewLeaderboard(client, "test:scores")
+
+	if _, err := lb.Rollover(ctx, "s1"); !errors.Is(err, ErrEmptyBoard) {
+		t.Fatalf("expected ErrEmptyBoard for an empty board, got %v", err)
+	}
+
+	submitAll(t, lb, "alice", 10, "bob", 20)
+	if err := lb.SetMetadata(ctx, "alice", Metadata{"name": "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := lb.Rollover(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := lb.TotalCount(ctx); n != 0 {
+		t.Fatalf("expected the live board to start over, got %d members", n)
+	}
+	if _, err := archive.SubmitScore(ctx, "carol", 5); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected the archive to be read-only, got %v", err)
+	}
+
+	// The archive keeps the metadata it ended with, even once the live one changes.
+	if err := lb.SetMetadata(ctx, "alice", Metadata{"name": "Alice II"}); err != nil {
+		t.Fatal(err)
+	}
+	top, err := archive.TopNWithMetadata(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].Member != "bob" || top[1].Metadata["name"] != "Alice" {
+		t.Fatalf("unexpected archived standings %+v", top)
+	}
+	if md, _ := lb.GetMetadata(ctx, "alice"); md["name"] != "Alice II" {
+		t.Fatalf("expected the live metadata to carry over, got %v", md)
+	}
+
+	submitAll(t, lb, "carol", 30)
+	if _, err := lb.Rollover(ctx, "s1"); !errors.Is(err, ErrSeasonExists) {
+		t.Fatalf("expected ErrSeasonExists, got %v", err)
+	}
+	if _, err := lb.Rollover(ctx, "s2"); err != nil {
+		t.Fatal(err)
+	}
+	seasons, err := lb.Seasons(ctx)
+	if err != nil || len(seasons) != 2 || seasons[0] != "s1" || seasons[1] != "s2" {
+		t.Fatalf("expected seasons [s1 s2], got %v, %v", seasons, err)
+	}
+}
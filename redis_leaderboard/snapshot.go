@@ -0,0 +1,252 @@
+package redis_leaderboard
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidSnapshot is returned by ReadSnapshot for malformed input.
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// Snapshot is a board's complete standings at one point in time, e.g. the
+// final standings of a season.
+type Snapshot struct {
+	Board    string          `json:"board"` // Key of the board's sorted set
+	Season   string          `json:"season,omitempty"`
+	TakenAt  time.Time       `json:"takenAt"`
+	Order    Order           `json:"order"`
+	TieBreak TieBreak        `json:"tieBreak"`
+	Entries  []SnapshotEntry `json:"entries"`
+}
+
+// SnapshotEntry is an Entry plus the exact sorted-set score, which also
+// carries the tie-break time, so a restore reproduces the same order.
+type SnapshotEntry struct {
+	Entry
+	Stored float64 `json:"stored"`
+}
+
+// Snapshot reads the whole board and its metadata in one MULTI/EXEC.
+func (lb *Leaderboard) Snapshot(ctx context.Context) (Snapshot, error) {
+	pipe := lb.client.TxPipeline()
+	scores := lb.zrange(ctx, pipe, lb.key, 0, -1)
+	metas := pipe.HGetAll(ctx, lb.metaKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Snapshot{}, err
+	}
+	zs := scores.Val()
+	entries, err := lb.rankEntries(ctx, 0, zs)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap := Snapshot{
+		Board:    lb.key,
+		Season:   lb.season,
+		TakenAt:  time.Now().UTC(),
+		Order:    lb.Order(),
+		TieBreak: lb.TieBreak(),
+		Entries:  make([]SnapshotEntry, len(entries)),
+	}
+	for i, e := range entries {
+		if data, ok := metas.Val()[e.Member]; ok {
+			if e.Metadata, err = parseMetadata(e.Member, data); err != nil {
+				return Snapshot{}, err
+			}
+		}
+		snap.Entries[i] = SnapshotEntry{Entry: e, Stored: zs[i].Score}
+	}
+	return snap, nil
+}
+
+// Restore replaces the board's standings with snap's and sets the metadata
+// it contains. With season set, snap is restored as that archived season
+// instead, replacing its archived metadata too, and the live board is left
+// alone. Stored scores are reused when
+// the board orders and breaks ties the same way as the snapshot; otherwise
+// scores are re-encoded as if reached when the snapshot was taken.
+func (lb *Leaderboard) Restore(ctx context.Context, snap Snapshot, season string) error {
+	key, metaKey := lb.key, lb.metaKey
+	if season != "" {
+		if err := validateSeason(season); err != nil {
+			return err
+		}
+		key = lb.seasonKey(season)
+		metaKey = key + ":meta"
+	} else if lb.readOnly {
+		return ErrReadOnly
+	}
+	sameEncoding := snap.Order == lb.Order() && snap.TieBreak == lb.TieBreak()
+	zs := make([]redis.Z, len(snap.Entries))
+	for i, e := range snap.Entries {
+		stored := e.Stored
+		if !sameEncoding {
+			var err error
+			if stored, err = lb.encode(e.Score, snap.TakenAt); err != nil {
+				return fmt.Errorf("restoring %q: %w", e.Member, err)
+			}
+		}
+		zs[i] = redis.Z{Score: stored, Member: e.Member}
+	}
+
+	// One transaction, so readers see either the old or the restored board.
+	// The dense index is dropped and rebuilt on first use.
+	pipe := lb.client.TxPipeline()
+	pipe.Del(ctx, denseKeys(key)...)
+	if season != "" {
+		pipe.Del(ctx, metaKey)
+	}
+	for start := 0; start < len(zs); start += 1000 {
+		pipe.ZAdd(ctx, key, zs[start:min(start+1000, len(zs))]...)
+	}
+	for _, e := range snap.Entries {
+		if len(e.Metadata) == 0 {
+			continue
+		}
+		data, err := json.Marshal(e.Metadata)
+		if err != nil {
+			return err
+		}
+		pipe.HSet(ctx, metaKey, e.Member, data)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// WriteJSON writes the snapshot as indented JSON.
+func (s Snapshot) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// csvHeader is the column row of CSV snapshots. The snapshot's own fields go
+// in a comment line above it.
+var csvHeader = []string{"rank", "member", "score", "stored", "metadata"}
+
+// WriteCSV writes the snapshot as CSV, one row per entry, with metadata as a
+// JSON column.
+func (s Snapshot) WriteCSV(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# board=%s season=%s takenAt=%s order=%s tieBreak=%s\n",
+		s.Board, s.Season, s.TakenAt.Format(time.RFC3339), s.Order, s.TieBreak); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range s.Entries {
+		var md string
+		if len(e.Metadata) > 0 {
+			data, err := json.Marshal(e.Metadata)
+			if err != nil {
+				return err
+			}
+			md = string(data)
+		}
+		row := []string{
+			strconv.FormatInt(e.Rank, 10),
+			e.Member,
+			strconv.FormatFloat(e.Score, 'f', -1, 64),
+			strconv.FormatFloat(e.Stored, 'f', -1, 64),
+			md,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadSnapshot reads a snapshot written by WriteJSON or WriteCSV.
+func ReadSnapshot(r io.Reader) (Snapshot, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			br.ReadByte()
+			continue
+		case '{':
+			var s Snapshot
+			if err := json.NewDecoder(br).Decode(&s); err != nil {
+				return Snapshot{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+			}
+			return s, nil
+		}
+		return readSnapshotCSV(br)
+	}
+}
+
+func readSnapshotCSV(br *bufio.Reader) (Snapshot, error) {
+	var s Snapshot
+	for {
+		b, err := br.Peek(1)
+		if err != nil || b[0] != '#' {
+			break
+		}
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return Snapshot{}, err
+		}
+		for _, field := range strings.Fields(strings.TrimPrefix(line, "#")) {
+			k, v, _ := strings.Cut(field, "=")
+			switch k {
+			case "board":
+				s.Board = v
+			case "season":
+				s.Season = v
+			case "takenAt":
+				if s.TakenAt, err = time.Parse(time.RFC3339, v); err != nil {
+					return Snapshot{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+				}
+			case "order":
+				s.Order = Order(v)
+			case "tieBreak":
+				s.TieBreak = TieBreak(v)
+			}
+		}
+	}
+
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = len(csvHeader)
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		return Snapshot{}, fmt.Errorf("%w: want header %q", ErrInvalidSnapshot, strings.Join(csvHeader, ","))
+	}
+	s.Entries = make([]SnapshotEntry, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		var e SnapshotEntry
+		var errs [3]error
+		e.Rank, errs[0] = strconv.ParseInt(row[0], 10, 64)
+		e.Member = row[1]
+		e.Score, errs[1] = strconv.ParseFloat(row[2], 64)
+		e.Stored, errs[2] = strconv.ParseFloat(row[3], 64)
+		if err := errors.Join(errs[:]...); err != nil {
+			return Snapshot{}, fmt.Errorf("%w: row %d: %v", ErrInvalidSnapshot, i+2, err)
+		}
+		if row[4] != "" {
+			if e.Metadata, err = parseMetadata(e.Member, row[4]); err != nil {
+				return Snapshot{}, fmt.Errorf("%w: row %d: %v", ErrInvalidSnapshot, i+2, err)
+			}
+		}
+		s.Entries = append(s.Entries, e)
+	}
+	return s, nil
+}
@@ -0,0 +1,118 @@
+package redis_leaderboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSnapshot() Snapshot {
+	return Snapshot{
+		Board:    "leaderboard:{arcade}:scores",
+		Season:   "2024-s1",
+		TakenAt:  time.Date(2024, time.June, 30, 23, 59, 59, 0, time.UTC),
+		Order:    Descending,
+		TieBreak: EarliestFirst,
+		Entries: []SnapshotEntry{
+			{Entry: Entry{Member: "bob", Score: 20, Rank: 1, Metadata: Metadata{"name": "Bob, \"the\" builder"}}, Stored: 20*tieScale + 7},
+			{Entry: Entry{Member: "alice", Score: -1.5, Rank: 2}, Stored: -1.5},
+		},
+	}
+}
+
+func TestSnapshotJSONAndCSVRoundTrip(t *testing.T) {
+	want := testSnapshot()
+	for name, write := range map[string]func(Snapshot, *bytes.Buffer) error{
+		"json": func(s Snapshot, b *bytes.Buffer) error { return s.WriteJSON(b) },
+		"csv":  func(s Snapshot, b *bytes.Buffer) error { return s.WriteCSV(b) },
+	} {
+		var buf bytes.Buffer
+		if err := write(want, &buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if name == "csv" && !strings.HasPrefix(buf.String(), "# board=leaderboard:{arcade}:scores season=2024-s1 takenAt=2024-06-30T23:59:59Z order=desc tieBreak=earliest\n") {
+			t.Fatalf("csv: unexpected header comment in\n%s", buf.String())
+		}
+		got, err := ReadSnapshot(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: round trip gave\n%+v\nwant\n%+v", name, got, want)
+		}
+	}
+}
+
+func TestReadSnapshotRejectsMalformedInput(t *testing.T) {
+	for name, input := range map[string]string{
+		"empty":        "",
+		"bad json":     `{"board": 1}`,
+		"wrong header": "rank,member,score\n1,alice,10\n",
+		"bad row":      "rank,member,score,stored,metadata\nfirst,alice,10,10,\n",
+		"bad takenAt":  "# takenAt=yesterday\nrank,member,score,stored,metadata\n",
+		"bad metadata": "rank,member,score,stored,metadata\n1,alice,10,10,{\n",
+	} {
+		if _, err := ReadSnapshot(strings.NewReader(input)); !errors.Is(err, ErrInvalidSnapshot) {
+			t.Errorf("%s: expected ErrInvalidSnapshot, got %v", name, err)
+		}
+	}
+}
+
+// Test that a snapshot restores as an archived season with its own metadata,
+// and onto a board that breaks ties differently by re-encoding the scores.
+func TestSnapshotAndRestore(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	lb := NewLeaderboard(client, "test:scores", WithTieBreak(EarliestFirst))
+	submitAll(t, lb, "alice", 10, "bob", 20)
+	if err := lb.SetMetadata(ctx, "bob", Metadata{"name": "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := lb.Snapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Entries) != 2 || snap.Entries[0].Member != "bob" || snap.Entries[0].Metadata["name"] != "Bob" {
+		t.Fatalf("unexpected snapshot %+v", snap)
+	}
+
+	if err := lb.Restore(ctx, snap, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	season, _ := lb.Season("s1")
+	restored, err := season.Snapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range restored.Entries {
+		if e.Member != snap.Entries[i].Member || e.Stored != snap.Entries[i].Stored || !reflect.DeepEqual(e.Metadata, snap.Entries[i].Metadata) {
+			t.Fatalf("season entry %d: got %+v, want %+v", i, e, snap.Entries[i])
+		}
+	}
+	// The season's metadata is its own.
+	if err := lb.SetMetadata(ctx, "bob", nil); err != nil {
+		t.Fatal(err)
+	}
+	if md, _ := season.GetMetadata(ctx, "bob"); md["name"] != "Bob" {
+		t.Fatalf("expected the season to keep bob's metadata, got %v", md)
+	}
+
+	plain := NewLeaderboard(client, "test:plain", WithOrder(Ascending))
+	if err := plain.Restore(ctx, snap, ""); err != nil {
+		t.Fatal(err)
+	}
+	top, err := plain.TopN(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top) != 2 || top[0].Member != "alice" || top[0].Score != 10 || top[1].Score != 20 {
+		t.Fatalf("expected re-encoded ascending standings, got %+v", top)
+	}
+	if err := season.Restore(ctx, snap, ""); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected restoring over a season view to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SubmitMode decides whether a submitted score replaces the member's current one.
+type SubmitMode string
+
+const (
+	// KeepLatest always replaces the current score. This is the default.
+	KeepLatest SubmitMode = "latest"
+	// KeepBest only replaces the current score with a better one (ZADD GT,
+	// or LT on Ascending boards).
+	KeepBest SubmitMode = "best"
+	// KeepWorst only replaces the current score with a worse one (ZADD LT,
+	// or GT on Ascending boards).
+	KeepWorst SubmitMode = "worst"
+)
+
+// ParseSubmitMode parses a submit mode name.
+func ParseSubmitMode(s string) (SubmitMode, error) {
+	switch m := SubmitMode(s); m {
+	case KeepLatest, KeepBest, KeepWorst:
+		return m, nil
+	case "":
+		return KeepLatest, nil
+	}
+	return "", fmt.Errorf("unknown submit mode %q", s)
+}
+
+// WithSubmitMode sets how SubmitScore treats a member's existing score.
+// It applies to the period sets too, so e.g. KeepBest keeps each day's best.
+func WithSubmitMode(m SubmitMode) Option {
+	return func(lb *Leaderboard) {
+		lb.submitMode = m
+	}
+}
+
+// SubmitResult describes the outcome of SubmitScore.
+type SubmitResult struct {
+	Member        string  `json:"member"`
+	Score         float64 `json:"score"`                   // Current score after the submission
+	PreviousScore float64 `json:"previousScore,omitempty"` // Only meaningful if PreviousRank > 0
+	PreviousRank  int64   `json:"previousRank"`            // 0 if the member was not on the board
+	Rank          int64   `json:"rank"`
+	Updated       bool    `json:"updated"`  // The stored score changed
+	Improved      bool    `json:"improved"` // The member now has a better score than before (or is new)
+}
+
+// zaddFlag returns the ZADD flag ("GT", "LT" or empty) for the board's
+// submit mode and order.
+func (lb *Leaderboard) zaddFlag() string {
+	switch {
+	case lb.submitMode == KeepBest && lb.ascending(), lb.submitMode == KeepWorst && !lb.ascending():
+		return "LT"
+	case lb.submitMode == KeepBest, lb.submitMode == KeepWorst:
+		return "GT"
+	}
+	return ""
+}
+
+// submitScript is ZADD CH with the flag ARGV[4] ("GT", "LT" or empty) that
+// also updates the dense index. With a tie-break scale ARGV[3] above 1, it
+// leaves ARGV[1] alone if its stored score ARGV[2] decodes to the score it
+// already has.
+var submitScript = redis.NewScript(denseLib + `
+local scale = tonumber(ARGV[3])
+denseEnsure(scale)
+local cur = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if scale > 1 and cur and band(cur, scale) == band(ARGV[2], scale) then
+	return 0
+end
+local n
+if ARGV[4] == "" then
+	n = redis.call("ZADD", KEYS[1], "CH", ARGV[2], ARGV[1])
+else
+	n = redis.call("ZADD", KEYS[1], ARGV[4], "CH", ARGV[2], ARGV[1])
+end
+if n > 0 then
+	denseMove(cur, redis.call("ZSCORE", KEYS[1], ARGV[1]), scale)
+end
+return n`)
+
+// queueSubmit queues the write of a submitted score to key and returns a
+// function reporting whether the stored score changed. With a time-based
+// tie-break, resubmitting the score a member already has keeps the time it
+// was first reached, so the member does not lose its place among the tied.
+func (lb *Leaderboard) queueSubmit(ctx context.Context, pipe redis.Pipeliner, key string, z redis.Z) func() bool {
+	cmd := submitScript.Eval(ctx, pipe, denseKeys(key), z.Member, z.Score, lb.bandScale(), lb.zaddFlag())
+	return func() bool {
+		n, _ := cmd.Int64()
+		return n > 0
+	}
+}
+
+// better reports whether score a ranks above score b.
+func (lb *Leaderboard) better(a, b float64) bool {
+	if lb.ascending() {
+		return a < b
+	}
+	return a > b
+}
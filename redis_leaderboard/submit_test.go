@@ -0,0 +1,67 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// Test each submit mode in both orders, with and without a time tie-break,
+// against a member that already has 50.
+func TestSubmitModes(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	for _, c := range []struct {
+		mode     SubmitMode
+		order    Order
+		score    float64
+		want     float64
+		improved bool
+	}{
+		{KeepLatest, Descending, 40, 40, false},
+		{KeepLatest, Descending, 60, 60, true},
+		{KeepBest, Descending, 40, 50, false},
+		{KeepBest, Descending, 60, 60, true},
+		{KeepWorst, Descending, 40, 40, false},
+		{KeepWorst, Descending, 60, 50, false},
+		{KeepLatest, Ascending, 40, 40, true},
+		{KeepLatest, Ascending, 60, 60, false},
+		{KeepBest, Ascending, 40, 40, true},
+		{KeepBest, Ascending, 60, 50, false},
+		{KeepWorst, Ascending, 40, 50, false},
+		{KeepWorst, Ascending, 60, 60, false},
+	} {
+		for _, tie := range []TieBreak{Lexicographic, EarliestFirst} {
+			name := fmt.Sprintf("%s/%s/%s/%v", c.mode, c.order, tie, c.score)
+			lb := NewLeaderboard(client, "test:"+name, WithSubmitMode(c.mode), WithOrder(c.order), WithTieBreak(tie))
+			submitAll(t, lb, "alice", 50, "bob", 45)
+
+			res, err := lb.SubmitScore(ctx, "alice", c.score)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if res.Score != c.want || res.PreviousScore != 50 || res.Updated != (c.want != 50) || res.Improved != c.improved {
+				t.Fatalf("%s: unexpected result %+v", name, res)
+			}
+			// bob's 45 sits between 40 and 50, so alice's rank follows her score.
+			wantRank := int64(1)
+			if lb.better(45, c.want) {
+				wantRank = 2
+			}
+			if res.Rank != wantRank {
+				t.Fatalf("%s: expected rank %d, got %d", name, wantRank, res.Rank)
+			}
+		}
+	}
+}
+
+func TestSubmitNewMember(t *testing.T) {
+	lb := NewLeaderboard(newTestClient(t), "test:scores", WithSubmitMode(KeepBest))
+	res, err := lb.SubmitScore(context.Background(), "alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.PreviousRank != 0 || res.Rank != 1 || !res.Updated || !res.Improved {
+		t.Fatalf("unexpected result for a new member %+v", res)
+	}
+}
@@ -0,0 +1,151 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TieBreak decides the order of members with equal scores.
+type TieBreak string
+
+const (
+	// Lexicographic leaves ties to Redis, which orders them by member name.
+	// Scores are stored as given. This is the default.
+	Lexicographic TieBreak = "lexicographic"
+	// EarliestFirst ranks whoever reached the score first higher.
+	EarliestFirst TieBreak = "earliest"
+	// LatestFirst ranks whoever reached the score most recently higher.
+	LatestFirst TieBreak = "latest"
+)
+
+// ParseTieBreak parses a tie-break mode name.
+func ParseTieBreak(s string) (TieBreak, error) {
+	switch t := TieBreak(s); t {
+	case Lexicographic, EarliestFirst, LatestFirst:
+		return t, nil
+	case "":
+		return Lexicographic, nil
+	}
+	return "", fmt.Errorf("unknown tie-break mode %q", s)
+}
+
+// With a time-based tie-break the sorted-set score packs the player's score
+// and the time it was reached into one float64:
+//
+//	stored = score * 2^31 + timePart
+//
+// where timePart is seconds since tieEpoch, inverted when needed so the
+// preferred time sorts first: for EarliestFirst on a Descending board
+// earlier is larger, for LatestFirst on an Ascending board later is
+// smaller. A float64 holds integers exactly up to 2^53, which leaves 22
+// bits for the score: scores must be whole numbers within
+// ±MaxTieBreakScore, and times are good until 2092.
+const (
+	tieTimeBits      = 31
+	tieScale         = 1 << tieTimeBits
+	MaxTieBreakScore = 1<<(53-tieTimeBits) - 1
+)
+
+var tieEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// ErrScoreOutOfRange is returned when a score cannot be encoded with the
+// board's tie-break mode.
+var ErrScoreOutOfRange = errors.New("score out of range for tie-break mode")
+
+// WithTieBreak sets how equal scores are ordered.
+func WithTieBreak(t TieBreak) Option {
+	return func(lb *Leaderboard) {
+		lb.tieBreak = t
+	}
+}
+
+// TieBreak returns how the board orders equal scores.
+func (lb *Leaderboard) TieBreak() TieBreak {
+	if lb.tieBreak == "" {
+		return Lexicographic
+	}
+	return lb.tieBreak
+}
+
+func (lb *Leaderboard) timeTieBreak() bool {
+	return lb.tieBreak == EarliestFirst || lb.tieBreak == LatestFirst
+}
+
+// timePart is the tie-breaking component for a score reached at t.
+func (lb *Leaderboard) timePart(t time.Time) float64 {
+	secs := int64(t.Sub(tieEpoch) / time.Second)
+	secs = max(0, min(secs, tieScale-1))
+	if (lb.tieBreak == EarliestFirst) != lb.ascending() {
+		secs = tieScale - 1 - secs
+	}
+	return float64(secs)
+}
+
+// encode converts a player's score reached at t to the stored score.
+func (lb *Leaderboard) encode(score float64, t time.Time) (float64, error) {
+	if !lb.timeTieBreak() {
+		return score, nil
+	}
+	if score != math.Trunc(score) || math.Abs(score) > MaxTieBreakScore {
+		return 0, fmt.Errorf("%w: %v (whole numbers up to ±%d)", ErrScoreOutOfRange, score, MaxTieBreakScore)
+	}
+	return score*tieScale + lb.timePart(t), nil
+}
+
+// decode recovers the player's score from a stored score.
+func (lb *Leaderboard) decode(stored float64) float64 {
+	if !lb.timeTieBreak() {
+		return stored
+	}
+	return math.Floor(stored / tieScale)
+}
+
+// incrScript adds ARGV[2] to the score of ARGV[1] and returns the new
+// (decoded) score, updating the dense index. With a tie-break scale ARGV[4]
+// above 1 it adds to the encoded score and restamps it with the time part
+// ARGV[3], refusing scores beyond ±ARGV[5].
+var incrScript = redis.NewScript(denseLib + `
+local scale = tonumber(ARGV[4])
+denseEnsure(scale)
+local cur = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if scale <= 1 then
+	local new = redis.call("ZINCRBY", KEYS[1], ARGV[2], ARGV[1])
+	denseMove(cur, new, scale)
+	return new
+end
+local base = 0
+if cur then
+	base = math.floor(tonumber(cur) / scale)
+end
+local new = base + tonumber(ARGV[2])
+if math.abs(new) > tonumber(ARGV[5]) then
+	return redis.error_reply("score out of range for tie-break mode")
+end
+-- %.0f keeps all 53 bits; tostring would round to 14 digits.
+local stored = string.format("%.0f", new * scale + tonumber(ARGV[3]))
+redis.call("ZADD", KEYS[1], stored, ARGV[1])
+denseMove(cur, stored, scale)
+return string.format("%.0f", new)`)
+
+// queueIncr queues an increment of member's score in key and returns a
+// function reporting the new score once the pipeline has run. With a
+// time-based tie-break the increment also moves the member's tie time to now.
+func (lb *Leaderboard) queueIncr(ctx context.Context, pipe redis.Pipeliner, key, member string, delta float64, now time.Time) func() (float64, error) {
+	var timePart float64
+	if lb.timeTieBreak() {
+		timePart = lb.timePart(now)
+	}
+	cmd := incrScript.Eval(ctx, pipe, denseKeys(key), member, delta, timePart, lb.bandScale(), MaxTieBreakScore)
+	return func() (float64, error) {
+		s, err := cmd.Text()
+		if err != nil {
+			return 0, err
+		}
+		return ParseScore(s)
+	}
+}
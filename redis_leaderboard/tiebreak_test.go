@@ -0,0 +1,99 @@
+package redis_leaderboard
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Test that encoded scores decode to the original score, negative ones
+// included, and that the preferred time sorts first in the board's order.
+func TestTieBreakEncodeDecode(t *testing.T) {
+	early, late := tieEpoch.Add(time.Hour), tieEpoch.Add(2*time.Hour)
+	for _, c := range []struct {
+		tie   TieBreak
+		order Order
+	}{
+		{EarliestFirst, Descending},
+		{EarliestFirst, Ascending},
+		{LatestFirst, Descending},
+		{LatestFirst, Ascending},
+	} {
+		lb := NewLeaderboard(nil, "", WithTieBreak(c.tie), WithOrder(c.order))
+		for _, score := range []float64{0, 1, -1, 1500, -1500, MaxTieBreakScore, -MaxTieBreakScore} {
+			stored, err := lb.encode(score, early)
+			if err != nil {
+				t.Fatalf("%s/%s: encode(%v): %v", c.tie, c.order, score, err)
+			}
+			if got := lb.decode(stored); got != score {
+				t.Fatalf("%s/%s: decode(encode(%v)) = %v", c.tie, c.order, score, got)
+			}
+		}
+
+		a, _ := lb.encode(100, early)
+		b, _ := lb.encode(100, late)
+		earlyFirst := lb.better(a, b)
+		if earlyFirst != (c.tie == EarliestFirst) {
+			t.Fatalf("%s/%s: wrong time ranks first (early %v, late %v)", c.tie, c.order, a, b)
+		}
+		// A better score wins whatever the times.
+		worse, _ := lb.encode(99, early)
+		better, _ := lb.encode(101, late)
+		if c.order == Ascending {
+			worse, better = better, worse
+		}
+		if !lb.better(better, a) || !lb.better(a, worse) {
+			t.Fatalf("%s/%s: time outweighed the score", c.tie, c.order)
+		}
+	}
+}
+
+// Test that scores beyond what fits in 53 bits next to the time, and
+// fractional scores, are refused.
+func TestTieBreakScoreBounds(t *testing.T) {
+	lb := NewLeaderboard(nil, "", WithTieBreak(EarliestFirst))
+	now := time.Now()
+	if stored, err := lb.encode(MaxTieBreakScore, now); err != nil || stored >= 1<<53 {
+		t.Fatalf("expected the largest score to fit below 2^53, got %v, %v", stored, err)
+	}
+	for _, score := range []float64{MaxTieBreakScore + 1, -MaxTieBreakScore - 1, 1.5} {
+		if _, err := lb.encode(score, now); !errors.Is(err, ErrScoreOutOfRange) {
+			t.Fatalf("encode(%v): expected ErrScoreOutOfRange, got %v", score, err)
+		}
+	}
+	plain := NewLeaderboard(nil, "")
+	if stored, err := plain.encode(1.5, now); err != nil || stored != 1.5 {
+		t.Fatalf("expected scores to be stored as given without a tie-break, got %v, %v", stored, err)
+	}
+}
+
+// Test that resubmitting the score a member already has keeps the time it
+// was first reached, so an earlier achiever keeps its place.
+func TestResubmitKeepsTieTime(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	lb := NewLeaderboard(client, "test:scores", WithTieBreak(EarliestFirst))
+
+	earlier, _ := lb.encode(100, time.Now().Add(-time.Hour))
+	client.ZAdd(ctx, lb.key, redis.Z{Score: earlier, Member: "alice"})
+	submitAll(t, lb, "bob", 100)
+
+	res, err := lb.SubmitScore(ctx, "alice", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Updated || res.Rank != 1 {
+		t.Fatalf("expected alice to stay first and unchanged, got %+v", res)
+	}
+	if stored := client.ZScore(ctx, lb.key, "alice").Val(); stored != earlier {
+		t.Fatalf("expected the stored score to keep its time, got %v want %v", stored, earlier)
+	}
+
+	res, err = lb.SubmitScore(ctx, "alice", 90)
+	if err != nil || !res.Updated || res.Score != 90 {
+		t.Fatalf("expected a different score to be written, got %+v, %v", res, err)
+	}
+}
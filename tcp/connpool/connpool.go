@@ -0,0 +1,267 @@
+package connpool
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrPoolClosed is returned by Get once the pool has been closed.
+var ErrPoolClosed = errors.New("connpool: pool is closed")
+
+// Dialer opens a new connection to the backend.
+type Dialer func(ctx context.Context) (net.Conn, error)
+
+// HealthCheck reports whether an idle connection is still usable.
+// It is run on every checkout of an idle connection.
+type HealthCheck func(conn net.Conn) error
+
+// Config configures a Pool. Zero values pick sensible defaults.
+type Config struct {
+	Dial        Dialer
+	MaxOpen     int           // Max connections open at once (idle + in use)
+	MaxIdle     int           // Max idle connections kept around; defaults to MaxOpen
+	IdleTimeout time.Duration // Close connections idle for longer than this; 0 = never
+	MaxLifetime time.Duration // Close connections older than this; 0 = never
+	HealthCheck HealthCheck   // Defaults to DefaultHealthCheck
+}
+
+// Stats is a snapshot of the pool state.
+type Stats struct {
+	Open      int   // Connections currently open (idle + in use)
+	Idle      int   // Connections waiting in the idle list
+	InUse     int   // Connections checked out by callers
+	WaitCount int64 // Total number of Get calls that had to wait for a slot
+}
+
+// idleConn holds the raw connection rather than the *Conn it was checked out
+// as, so each checkout gets a fresh Conn whose Close releases its own slot.
+type idleConn struct {
+	conn      net.Conn
+	createdAt time.Time
+	returned  time.Time
+}
+
+// Pool is a client-side TCP connection pool. Get blocks (respecting the
+// context) when MaxOpen connections are already checked out.
+type Pool struct {
+	cfg       Config
+	slots     chan struct{} // One token per connection allowed to be open
+	done      chan struct{} // Closed by Close to wake waiting Gets
+	mu        sync.Mutex
+	idle      []idleConn // LIFO: most recently returned at the end
+	numOpen   int
+	waitCount int64
+	closed    bool
+}
+
+// NewPool creates a Pool. Connections are dialled lazily on first Get.
+func NewPool(cfg Config) (*Pool, error) {
+	if cfg.Dial == nil {
+		return nil, errors.New("connpool: Dial is required")
+	}
+	if cfg.MaxOpen <= 0 {
+		return nil, errors.New("connpool: MaxOpen must be positive")
+	}
+	if cfg.MaxIdle <= 0 || cfg.MaxIdle > cfg.MaxOpen {
+		cfg.MaxIdle = cfg.MaxOpen
+	}
+	if cfg.HealthCheck == nil {
+		cfg.HealthCheck = DefaultHealthCheck
+	}
+	return &Pool{
+		cfg:   cfg,
+		slots: make(chan struct{}, cfg.MaxOpen),
+		done:  make(chan struct{}),
+	}, nil
+}
+
+// Get checks out a connection, reusing a healthy idle one when possible.
+// If MaxOpen connections are in use it waits until one is returned, ctx is
+// done, or the pool is closed.
+func (p *Pool) Get(ctx context.Context) (*Conn, error) {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		p.mu.Lock()
+		p.waitCount++
+		p.mu.Unlock()
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-p.done:
+			return nil, ErrPoolClosed
+		}
+	}
+
+	for {
+		c, ok := p.popIdle()
+		if !ok {
+			break
+		}
+		if err := p.cfg.HealthCheck(c.Conn); err != nil {
+			p.discard(c)
+			continue
+		}
+		return c, nil
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.slots
+		return nil, ErrPoolClosed
+	}
+	p.numOpen++
+	p.mu.Unlock()
+
+	nc, err := p.cfg.Dial(ctx)
+	if err != nil {
+		p.mu.Lock()
+		p.numOpen--
+		p.mu.Unlock()
+		<-p.slots
+		return nil, err
+	}
+	return &Conn{Conn: nc, pool: p, createdAt: time.Now()}, nil
+}
+
+// popIdle removes and returns the freshest idle connection that has not
+// exceeded its idle timeout or lifetime. Stale ones are closed on the way.
+func (p *Pool) popIdle() (*Conn, bool) {
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.idle) > 0 {
+		ic := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if p.expired(ic, now) {
+			ic.conn.Close()
+			p.numOpen--
+			continue
+		}
+		return &Conn{Conn: ic.conn, pool: p, createdAt: ic.createdAt}, true
+	}
+	return nil, false
+}
+
+func (p *Pool) expired(ic idleConn, now time.Time) bool {
+	if p.cfg.IdleTimeout > 0 && now.Sub(ic.returned) > p.cfg.IdleTimeout {
+		return true
+	}
+	if p.cfg.MaxLifetime > 0 && now.Sub(ic.createdAt) > p.cfg.MaxLifetime {
+		return true
+	}
+	return false
+}
+
+// put returns a checked-out connection to the idle list, or closes it if it
+// is unusable, too old, or the idle list is full.
+func (p *Pool) put(c *Conn) {
+	defer func() { <-p.slots }()
+
+	now := time.Now()
+	p.mu.Lock()
+	keep := !p.closed && !c.unusable.Load() && len(p.idle) < p.cfg.MaxIdle &&
+		(p.cfg.MaxLifetime <= 0 || now.Sub(c.createdAt) <= p.cfg.MaxLifetime)
+	if keep {
+		p.idle = append(p.idle, idleConn{conn: c.Conn, createdAt: c.createdAt, returned: now})
+		p.mu.Unlock()
+		return
+	}
+	p.numOpen--
+	p.mu.Unlock()
+	c.Conn.Close()
+}
+
+// discard closes a connection that failed its health check. The caller still
+// holds its slot, so it is not released here.
+func (p *Pool) discard(c *Conn) {
+	c.Conn.Close()
+	p.mu.Lock()
+	p.numOpen--
+	p.mu.Unlock()
+}
+
+// Stats returns a snapshot of the pool counters.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{
+		Open:      p.numOpen,
+		Idle:      len(p.idle),
+		InUse:     p.numOpen - len(p.idle),
+		WaitCount: p.waitCount,
+	}
+}
+
+// Close closes all idle connections and makes future Gets, including those
+// already waiting, fail. Connections still checked out are closed when they
+// are returned.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	for _, ic := range p.idle {
+		ic.conn.Close()
+		p.numOpen--
+	}
+	p.idle = nil
+	return nil
+}
+
+// Conn is a pooled connection. Close returns it to the pool instead of
+// closing the underlying socket.
+type Conn struct {
+	net.Conn
+	pool      *Pool
+	createdAt time.Time
+	unusable  atomic.Bool
+	release   sync.Once
+}
+
+// MarkUnusable makes Close drop the connection instead of pooling it.
+// Call it after an I/O error or when the peer has closed its side.
+func (c *Conn) MarkUnusable() {
+	c.unusable.Store(true)
+}
+
+// Close returns the connection to the pool. It is safe to call more than
+// once, from any goroutine.
+func (c *Conn) Close() error {
+	c.release.Do(func() { c.pool.put(c) })
+	return nil
+}
+
+// DefaultHealthCheck does a non-blocking one-byte read. A read timeout means
+// the connection is idle and healthy; EOF, any other error, or unexpected
+// pending data means it should not be reused.
+func DefaultHealthCheck(conn net.Conn) error {
+	if err := conn.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		return err
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	var buf [1]byte
+	n, err := conn.Read(buf[:])
+	if n > 0 {
+		return errors.New("connpool: unexpected data on idle connection")
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,246 @@
+package connpool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeDialer dials in-memory connections and keeps the server ends so tests
+// can close them, as a server hanging up would.
+type pipeDialer struct {
+	mu    sync.Mutex
+	peers []net.Conn
+}
+
+func (d *pipeDialer) dial(ctx context.Context) (net.Conn, error) {
+	client, server := net.Pipe()
+	d.mu.Lock()
+	d.peers = append(d.peers, server)
+	d.mu.Unlock()
+	return client, nil
+}
+
+func (d *pipeDialer) dials() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.peers)
+}
+
+func (d *pipeDialer) closeAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.peers {
+		c.Close()
+	}
+}
+
+func newTestPool(t *testing.T, cfg Config) (*Pool, *pipeDialer) {
+	t.Helper()
+	d := &pipeDialer{}
+	cfg.Dial = d.dial
+	p, err := NewPool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		p.Close()
+		d.closeAll()
+	})
+	return p, d
+}
+
+func mustGet(t *testing.T, p *Pool) *Conn {
+	t.Helper()
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	return c
+}
+
+func TestReuseIdleConnection(t *testing.T) {
+	p, d := newTestPool(t, Config{MaxOpen: 1})
+	c := mustGet(t, p)
+	c.Close()
+	if s := p.Stats(); s.Open != 1 || s.Idle != 1 || s.InUse != 0 {
+		t.Fatalf("unexpected stats after Close: %+v", s)
+	}
+
+	// Each checkout of the same connection must release its slot on Close,
+	// or a pool of one deadlocks on the third Get.
+	for i := 0; i < 3; i++ {
+		again := mustGet(t, p)
+		if again.Conn != c.Conn {
+			t.Fatal("expected the idle connection to be reused")
+		}
+		if s := p.Stats(); s.Open != 1 || s.Idle != 0 || s.InUse != 1 {
+			t.Fatalf("unexpected stats while checked out: %+v", s)
+		}
+		again.Close()
+		if s := p.Stats(); s.Open != 1 || s.Idle != 1 || s.InUse != 0 {
+			t.Fatalf("unexpected stats after returning a reused connection: %+v", s)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := p.Get(ctx); err != nil {
+		t.Fatalf("Get after reusing a connection: %v", err)
+	}
+	if n := d.dials(); n != 1 {
+		t.Fatalf("expected 1 dial, got %d", n)
+	}
+}
+
+func TestHealthCheckDropsClosedConnection(t *testing.T) {
+	p, d := newTestPool(t, Config{MaxOpen: 2})
+	c := mustGet(t, p)
+	c.Close()
+	d.closeAll() // The server hangs up while the connection is idle
+
+	if again := mustGet(t, p); again.Conn == c.Conn {
+		t.Fatal("expected a connection closed by the peer to be replaced")
+	}
+	if s := p.Stats(); d.dials() != 2 || s.Open != 1 {
+		t.Fatalf("expected a fresh dial replacing the dead connection, got %d dials and %+v", d.dials(), s)
+	}
+}
+
+func TestMarkUnusableDropsConnection(t *testing.T) {
+	p, _ := newTestPool(t, Config{MaxOpen: 2})
+	c := mustGet(t, p)
+	c.MarkUnusable()
+	c.Close()
+	if s := p.Stats(); s.Open != 0 || s.Idle != 0 {
+		t.Fatalf("expected an unusable connection to be closed, got %+v", s)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	p, d := newTestPool(t, Config{MaxOpen: 2, IdleTimeout: 10 * time.Millisecond})
+	c := mustGet(t, p)
+	c.Close()
+	time.Sleep(20 * time.Millisecond)
+
+	if again := mustGet(t, p); again.Conn == c.Conn {
+		t.Fatal("expected a connection idle past IdleTimeout to be replaced")
+	}
+	if n := d.dials(); n != 2 {
+		t.Fatalf("expected 2 dials, got %d", n)
+	}
+	if s := p.Stats(); s.Open != 1 {
+		t.Fatalf("expected the stale connection to be closed, got %+v", s)
+	}
+}
+
+func TestMaxLifetime(t *testing.T) {
+	p, d := newTestPool(t, Config{MaxOpen: 2, MaxLifetime: 10 * time.Millisecond})
+	c := mustGet(t, p)
+	time.Sleep(20 * time.Millisecond)
+	c.Close()
+	if s := p.Stats(); s.Open != 0 || s.Idle != 0 {
+		t.Fatalf("expected a connection past MaxLifetime not to be pooled, got %+v", s)
+	}
+
+	c = mustGet(t, p)
+	c.Close()
+	time.Sleep(20 * time.Millisecond)
+	if again := mustGet(t, p); again.Conn == c.Conn {
+		t.Fatal("expected an idle connection past MaxLifetime to be replaced")
+	}
+	if n := d.dials(); n != 3 {
+		t.Fatalf("expected 3 dials, got %d", n)
+	}
+}
+
+func TestGetWaitsForSlot(t *testing.T) {
+	p, _ := newTestPool(t, Config{MaxOpen: 1})
+	c := mustGet(t, p)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded while the pool is full, got %v", err)
+	}
+
+	got := make(chan *Conn, 1)
+	go func() {
+		c, err := p.Get(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		got <- c
+	}()
+	waitFor(t, func() bool { return p.Stats().WaitCount == 2 })
+	c.Close()
+	select {
+	case again := <-got:
+		if again.Conn != c.Conn {
+			t.Fatal("expected the waiter to receive the returned connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get did not return after a connection was released")
+	}
+}
+
+func TestCloseWakesWaiters(t *testing.T) {
+	p, _ := newTestPool(t, Config{MaxOpen: 1})
+	c := mustGet(t, p)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := p.Get(context.Background())
+		errs <- err
+	}()
+	waitFor(t, func() bool { return p.Stats().WaitCount == 1 })
+	p.Close()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrPoolClosed) {
+			t.Fatalf("expected ErrPoolClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get kept waiting after Close")
+	}
+
+	// The connection still checked out is closed, not pooled, when returned.
+	c.Close()
+	if s := p.Stats(); s.Open != 0 || s.Idle != 0 {
+		t.Fatalf("expected no open connections, got %+v", s)
+	}
+	if _, err := p.Get(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expected ErrPoolClosed, got %v", err)
+	}
+}
+
+// Test that concurrent Closes return the connection exactly once.
+func TestConcurrentConnClose(t *testing.T) {
+	p, _ := newTestPool(t, Config{MaxOpen: 1})
+	c := mustGet(t, p)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Close()
+		}()
+	}
+	wg.Wait()
+	if s := p.Stats(); s.Open != 1 || s.Idle != 1 {
+		t.Fatalf("expected one idle connection, got %+v", s)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
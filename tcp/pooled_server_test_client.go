@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/poeticcode01/poc/tcp/connpool"
 )
 
 const (
@@ -15,6 +21,7 @@ const (
 	numConnections      = 20                    // Number of connections to attempt
 	concurrentClients   = 10                    // How many client goroutines to launch in parallel
 	initialConnectDelay = 50 * time.Millisecond // Delay between launching client goroutines
+	checkoutTimeout     = 30 * time.Second      // How long a client waits for a free pooled connection
 )
 
 func main() {
@@ -24,26 +31,39 @@ func main() {
 	var wg sync.WaitGroup
 	results := make(chan string, numConnections) // Channel to collect results
 
-	// Use a semaphore to limit concurrent client goroutines
-	sem := make(chan struct{}, concurrentClients)
+	// The pool caps open connections at `concurrentClients`; extra clients wait for a free one
+	pool, err := connpool.NewPool(connpool.Config{
+		Dial: func(ctx context.Context) (net.Conn, error) {
+			d := net.Dialer{Timeout: 1 * time.Second} // 1-second dial timeout
+			return d.DialContext(ctx, "tcp", serverAddr)
+		},
+		MaxOpen:     concurrentClients,
+		IdleTimeout: 30 * time.Second,
+		MaxLifetime: 5 * time.Minute,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create connection pool: %v", err)
+	}
+	defer pool.Close()
 
 	for i := 0; i < numConnections; i++ {
-		sem <- struct{}{} // Acquire a token, block if `concurrentClients` are already running
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
-			defer func() { <-sem }() // Release the token when client goroutine finishes
 
-			conn, err := net.DialTimeout("tcp", serverAddr, 1*time.Second) // 1-second dial timeout
+			ctx, cancel := context.WithTimeout(context.Background(), checkoutTimeout)
+			defer cancel()
+			conn, err := pool.Get(ctx)
 			if err != nil {
 				results <- fmt.Sprintf("Client %d: Connection failed: %v", id, err)
 				return
 			}
-			defer conn.Close()
+			defer conn.Close() // Returns the connection to the pool
 
 			request := "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"
 			_, err = conn.Write([]byte(request))
 			if err != nil {
+				conn.MarkUnusable()
 				if strings.Contains(err.Error(), "connection reset by peer") || strings.Contains(err.Error(), "broken pipe") {
 					results <- fmt.Sprintf("Client %d: Rejected by Server (Capacity Exceeded)", id)
 				} else {
@@ -52,24 +72,33 @@ func main() {
 				return
 			}
 
-			response, err := ioutil.ReadAll(conn)
+			// Read exactly one framed response so the connection is left clean for
+			// the next request. If the server hangs up afterwards, the pool's
+			// health check drops the connection on its next checkout.
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err == nil {
+				_, err = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
 			if err != nil {
-				if strings.Contains(err.Error(), "connection reset by peer") || strings.Contains(err.Error(), "read: connection reset by peer") {
+				conn.MarkUnusable()
+				// A rejected connection is closed before any response is sent
+				if errors.Is(err, io.ErrUnexpectedEOF) || strings.Contains(err.Error(), "connection reset by peer") {
 					results <- fmt.Sprintf("Client %d: Rejected by Server (Capacity Exceeded)", id)
 				} else {
 					results <- fmt.Sprintf("Client %d: Read failed: %v", id, err)
 				}
 				return
 			}
+			if resp.Close {
+				conn.MarkUnusable()
+			}
 
 			// For this simulation, we're expecting "OK" from the server
-			responseStr := strings.TrimSpace(string(response))
-			if strings.Contains(responseStr, "HTTP/1.1 200 OK") {
+			if resp.StatusCode == http.StatusOK {
 				results <- fmt.Sprintf("Client %d: Processed (OK)", id)
-			} else if responseStr == "Hello from raw TCP worker pool server!" {
-				results <- fmt.Sprintf("Client %d: Generic TCP response (Queue or default path)", id)
 			} else {
-				results <- fmt.Sprintf("Client %d: Unexpected response: %q", id, responseStr)
+				results <- fmt.Sprintf("Client %d: Unexpected response: %s", id, resp.Status)
 			}
 
 		}(i + 1)
@@ -79,6 +108,8 @@ func main() {
 	wg.Wait() // Wait for all client goroutines to complete
 	close(results)
 
+	stats := pool.Stats()
+
 	// Print all collected results
 	fmt.Println("\n--- Test Results ---")
 	processedCount := 0
@@ -100,5 +131,6 @@ func main() {
 	fmt.Printf("  Processed (OK): %d\n", processedCount)
 	fmt.Printf("  Rejected: %d\n", rejectedCount)
 	fmt.Printf("  Other/Errors: %d\n", otherCount)
+	fmt.Printf("  Pool waits: %d\n", stats.WaitCount)
 	fmt.Println("--- Pooled Server Test Client Finished ---")
 }